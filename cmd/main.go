@@ -1,12 +1,19 @@
 package main
 
 import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
 
+	"github.com/emersion/go-imap/client"
 	"github.com/vky5/mailcat/internal/db"
 	"github.com/vky5/mailcat/internal/db/models"
 	"github.com/vky5/mailcat/internal/imap"
 	"github.com/vky5/mailcat/internal/logger"
 	"github.com/vky5/mailcat/internal/ui"
+	"golang.org/x/term"
 )
 
 func main() {
@@ -18,6 +25,12 @@ func main() {
 
 	db.InitDB()
 
+	// account passwords are encrypted with a key derived from this, asked once per start
+	if err := unlockVault(); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to unlock stored credentials:", err)
+		os.Exit(1)
+	}
+
 	var dbAccounts []models.Account
 	if err := db.DB.Find(&dbAccounts).Error; err != nil {
 		logger.Log.Fatalf("Failed to fetch accounts from DB: %v", err)
@@ -27,22 +40,32 @@ func main() {
 	uiAccounts := make([]*ui.Account, len(dbAccounts))
 
 	for i := range dbAccounts {
-		conn, err := imap.GetConnection(dbAccounts[i])
-		if err != nil {
+		var folders []imap.Mailbox
+		connected := false
+		err := imap.Do(dbAccounts[i], func(conn *client.Client) error {
+			connected = true
+			var err error
+			folders, err = imap.ListMailboxes(conn)
+			return err
+		})
+		if !connected {
 			logger.Error("Failed IMAP connection for", dbAccounts[i].Email, err)
 			continue
 		}
-
-		folders, err := imap.ListMailboxes(conn)
 		if err != nil {
 			logger.Error("Failed to list mailboxes", err)
-			folders = []string{"INBOX"}
+			folders = []imap.Mailbox{{Name: "INBOX"}}
 		}
 
 		uiFolders := make([]ui.Folder, len(folders))
 		for j, f := range folders {
-			uiFolders[j] = ui.Folder{Name: f}
-			logger.Log.Println("Loaded folder:", f)
+			uiFolders[j] = ui.Folder{
+				Name:       f.Name,
+				Delimiter:  f.Delimiter,
+				SpecialUse: f.SpecialUse(),
+				Noselect:   !f.Selectable(),
+			}
+			logger.Log.Println("Loaded folder:", f.Name, f.Attributes)
 		}
 
 		uiAccounts[i] = &ui.Account{
@@ -57,3 +80,67 @@ func main() {
 		panic(err)
 	}
 }
+
+// unlockVault asks for the master passphrase (twice the very first time) and unlocks the stored secrets.
+// MAILCAT_PASSPHRASE is used instead of prompting when set
+func unlockVault() error {
+	if pass := os.Getenv("MAILCAT_PASSPHRASE"); pass != "" {
+		return db.OpenVault(pass)
+	}
+
+	exists, err := db.HasVault()
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		fmt.Println("Choose a master passphrase, it encrypts the account passwords stored by mailcat.")
+		pass, err := readPassphrase("New passphrase: ")
+		if err != nil {
+			return err
+		}
+		again, err := readPassphrase("Repeat passphrase: ")
+		if err != nil {
+			return err
+		}
+		if pass != again {
+			return fmt.Errorf("passphrases don't match")
+		}
+		return db.OpenVault(pass)
+	}
+
+	// a few tries for typos before giving up
+	for attempt := 1; ; attempt++ {
+		pass, err := readPassphrase("Passphrase: ")
+		if err != nil {
+			return err
+		}
+		err = db.OpenVault(pass)
+		if err == nil || attempt == 3 {
+			return err
+		}
+		fmt.Println(err)
+	}
+}
+
+// stdin when it isn't a terminal, one reader for every prompt: a reader per call would
+// buffer the lines meant for the prompts after it
+var stdin = bufio.NewReader(os.Stdin)
+
+// readPassphrase reads a line without echo, or a plain line when stdin isn't a terminal
+func readPassphrase(prompt string) (string, error) {
+	fmt.Print(prompt)
+	fd := int(os.Stdin.Fd())
+
+	if !term.IsTerminal(fd) {
+		line, err := stdin.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil // last line without a newline
+		}
+		return strings.TrimRight(line, "\r\n"), err
+	}
+
+	pass, err := term.ReadPassword(fd)
+	fmt.Println()
+	return string(pass), err
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/vky5/mailcat/internal/credentials"
 	"github.com/vky5/mailcat/internal/db"
 	"github.com/vky5/mailcat/internal/db/models"
 )
@@ -33,12 +34,36 @@ func CreateAccount(c *gin.Context) {
 		return
 	}
 
+	// the other sources run a command or read this machine's environment and files,
+	// an API client could have them send anything to a server of its choice
+	if !apiCredentialSources[account.CredentialSource] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "credential source " + account.CredentialSource + " can only be set up from the TUI"})
+		return
+	}
+	account.ID = 0
+	account.CredentialRef = ""
+
 	if err := db.DB.Create(&account).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create account"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, account)
+	c.JSON(http.StatusCreated, withoutSecrets(account))
+}
+
+// credential sources an API client may pick
+var apiCredentialSources = map[string]bool{
+	"":                       true,
+	credentials.SourceStored: true,
+	credentials.SourceOAuth2: true,
+}
+
+// withoutSecrets blanks what the DB keeps encrypted, loaded accounts hold it in plain text
+func withoutSecrets(acc models.Account) models.Account {
+	acc.Password = ""
+	acc.OAuthClientSecret = ""
+	acc.OAuthRefreshToken = ""
+	return acc
 }
 
 func GetAccounts(c *gin.Context) {
@@ -48,6 +73,9 @@ func GetAccounts(c *gin.Context) {
 		return
 	}
 
+	for i := range accounts {
+		accounts[i] = withoutSecrets(accounts[i])
+	}
 	c.JSON(http.StatusOK, accounts)
 }
 
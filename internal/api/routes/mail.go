@@ -6,11 +6,15 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 
+	"github.com/emersion/go-imap/client"
 	"github.com/gin-gonic/gin"
 	"github.com/vky5/mailcat/internal/db"
 	"github.com/vky5/mailcat/internal/db/models"
 	"github.com/vky5/mailcat/internal/imap"
+	"github.com/vky5/mailcat/internal/search"
+	"github.com/vky5/mailcat/internal/watcher"
 	"gorm.io/gorm"
 )
 
@@ -18,9 +22,110 @@ func RegisterMailRoutes(r *gin.Engine) {
 	acc := r.Group("/mail")
 	{
 		acc.POST("/stream", streamMails)
+		acc.GET("/events", streamEvents)
+		acc.POST("/move", moveMails)
+		acc.POST("/copy", copyMails)
+		acc.GET("/search", searchMails)
 	}
 }
 
+type TransferRequest struct {
+	Email     string   `json:"email"`
+	Mailbox   string   `json:"mailbox"`
+	UIDs      []uint32 `json:"uids"`
+	ToEmail   string   `json:"toemail"` // empty for the same account
+	ToMailbox string   `json:"tomailbox"`
+}
+
+func moveMails(c *gin.Context) {
+	transferMails(c, true)
+}
+
+func copyMails(c *gin.Context) {
+	transferMails(c, false)
+}
+
+// transferMails moves or copies messages to a folder of the same or another account
+func transferMails(c *gin.Context, move bool) {
+	var req TransferRequest
+	if err := c.ShouldBindBodyWithJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Mailbox == "" || req.ToMailbox == "" || len(req.UIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mailbox, tomailbox and uids are required"})
+		return
+	}
+	if req.ToEmail == "" {
+		req.ToEmail = req.Email
+	}
+
+	src, err := db.GetAccountByEmail(req.Email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "email not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Someting went wrong"})
+		}
+		return
+	}
+
+	dst, err := db.GetAccountByEmail(req.ToEmail)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "target email not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Someting went wrong"})
+		}
+		return
+	}
+
+	if err := imap.Transfer(*src, req.Mailbox, req.UIDs, *dst, req.ToMailbox, move); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"msg": "ok", "count": len(req.UIDs)})
+}
+
+// searchMails searches the cached mail, it never touches the server so it works offline.
+// ?q= takes the same query as the TUI, email and mailbox narrow it down (all accounts and folders by default)
+func searchMails(c *gin.Context) {
+	q, err := search.Parse(c.Query("q"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+		return
+	}
+
+	accountID := uint(0)
+	if email := c.Query("email"); email != "" {
+		account, err := db.GetAccountByEmail(email)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "email not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Someting went wrong"})
+			}
+			return
+		}
+		accountID = account.ID
+	}
+
+	hits, err := db.SearchCache(accountID, c.Query("mailbox"), q, limit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"count": len(hits), "results": hits})
+}
+
 type StreamRequest struct {
 	Email      string `json:"email"`
 	Mailbox    string `json:"mailbox"`
@@ -47,6 +152,10 @@ func streamMails(c *gin.Context) {
 		return
 	}
 
+	if req.Mailbox == "" {
+		req.Mailbox = "INBOX"
+	}
+
 	// search for the account through email
 	account, err := db.GetAccountByEmail(req.Email)
 	if err != nil {
@@ -60,22 +169,31 @@ func streamMails(c *gin.Context) {
 		}
 	}
 
-	// connect to imap
-	conn, err := imap.ConnectIMAP(*account) // this will stuck here until the the connection is established
+	// fetch on a pooled worker connection, this will stuck here until one is free and connected
 	// what I am thinking is that I create a channel of the pagesize automatically and then fetch the messages from the pagesize using range and then continously stream it but better stream new emails because
 	// if we try to stream mails like that seqset takes gives mail in ascending order 41 42 ... 50 and if we want 50th at the first place it is way more headache
-	if err != nil {
+	var emails []models.Email
+	connected := false
+	err = imap.Do(*account, func(conn *client.Client) error {
+		connected = true
+		var err error
+		emails, err = imap.FetchEmails(conn, req.Mailbox, req.PageSize, req.PageNumber)
+		return err
+	})
+	if !connected {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to connect to imap"})
 		return
 	}
-	defer imap.Logout(conn)
-
-	emails, err := imap.FetchEmails(conn,"INBOX", req.PageSize, req.PageNumber)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// keep the local cache warm with whatever we fetched
+	if err := db.SaveEmails(account.ID, req.Mailbox, emails); err != nil {
+		log.Println("failed to cache emails:", err)
+	}
+
 	// encode full batch as JSON
 	data, err := json.Marshal(emails)
 	if err != nil {
@@ -88,19 +206,78 @@ func streamMails(c *gin.Context) {
 	fmt.Fprintf(c.Writer, "data: %s\n\n", data)
 	flusher.Flush()
 
-	newEmails := make(chan models.Email, 100)
-	go func() {
-		if err := imap.ListenNewEmails(conn, req.Mailbox, newEmails); err != nil {
-			log.Println("ListenNewEmails error:", err)
+	// new mail comes from the watcher, which follows this mailbox for as long as the client listens
+	events, unsubscribe := watcher.Subscribe()
+	defer unsubscribe()
+	defer watcher.Follow(account.ID, req.Mailbox)()
+
+	// continously stream new emails to client, oldest first
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case ev := <-events:
+			if ev.AccountID != account.ID || ev.Mailbox != req.Mailbox {
+				continue
+			}
+			for i := len(ev.New) - 1; i >= 0; i-- {
+				data, _ := json.Marshal(ev.New[i])
+				fmt.Fprintf(c.Writer, "event: email\n")
+				fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+			}
+			flusher.Flush()
 		}
-	}()
+	}
+}
+
+// streamEvents sends every watcher event (new, deleted and changed messages) as SSE,
+// ?email= limits it to one account
+func streamEvents(c *gin.Context) {
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "streaming unsupported"})
+		return
+	}
 
-	// continously stream new emails to client
-	for email := range newEmails {
-		data, _ := json.Marshal(email)
-		fmt.Fprintf(c.Writer, "event: email\n")
-		fmt.Fprintf(c.Writer, "data: %s\n\n", data)
-		flusher.Flush()
+	var accountID uint
+	if email := c.Query("email"); email != "" {
+		account, err := db.GetAccountByEmail(email)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "email not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Someting went wrong"})
+			}
+			return
+		}
+		accountID = account.ID
 	}
 
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Writer.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	events, unsubscribe := watcher.Subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case ev := <-events:
+			if accountID != 0 && ev.AccountID != accountID {
+				continue
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				log.Println("failed to encode event:", err)
+				continue
+			}
+			fmt.Fprintf(c.Writer, "event: mailbox\n")
+			fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
 }
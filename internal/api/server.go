@@ -3,11 +3,15 @@ package api
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/vky5/mailcat/internal/api/routes"
+	"github.com/vky5/mailcat/internal/watcher"
 )
 
 func SetupServer() *gin.Engine {
 	r := gin.Default()
 
+	// the event streams are fed by the watcher
+	watcher.Start()
+
 	// register all routes
 	routes.RegisterAccountRoutes(r)
 	routes.RegisterMailRoutes(r)
@@ -3,21 +3,55 @@ package commands
 import (
 	"strings"
 
+	"github.com/vky5/mailcat/internal/credentials"
 	"github.com/vky5/mailcat/internal/db"
 	"github.com/vky5/mailcat/internal/db/models"
+	"github.com/vky5/mailcat/internal/imap"
+	"github.com/vky5/mailcat/internal/smtp"
+	"github.com/vky5/mailcat/internal/watcher"
+)
+
+// the questions asked by !addaccount, in order. some are skipped depending on earlier answers
+const (
+	stepEmail = iota
+	stepSource
+	stepSecret
+	stepOAuthTokenURL
+	stepOAuthClientID
+	stepOAuthClientSecret
+	stepOAuthRefreshToken
+	stepHost
+	stepSecurity
+	stepPort
+	stepSMTPHost
+	stepSMTPSecurity
+	stepSMTPPort
+	stepAllowPlaintext
 )
 
 type AddAccount struct {
 	step     int
 	email    string
-	password string
+	source   string // credentials.Source*
+	password string // the password itself, or the command / variable name for those sources
 	host     string
 	port     string
-	secure   bool
+	security string
+
+	smtpHost     string
+	smtpSecurity string
+	smtpPort     string
+
+	allowPlaintext bool
+
+	oauthTokenURL     string
+	oauthClientID     string
+	oauthClientSecret string
+	oauthRefreshToken string
 }
 
 func NewAddAccount() *AddAccount {
-	return &AddAccount{step: 0}
+	return &AddAccount{step: stepEmail}
 }
 
 func (ac *AddAccount) Name() string {
@@ -29,57 +63,204 @@ func (ac *AddAccount) Description() string {
 }
 
 func (ac *AddAccount) Begin(ctx Context) {
+	*ac = AddAccount{} // the same instance is reused for every run
 	ctx.ShowPlaceholder("Enter email:")
 }
 
 func (ac *AddAccount) HandleInput(input string, ctx Context) bool {
 	switch ac.step {
 
-	case 0:
+	case stepEmail:
 		ac.email = input
-		ac.step++
-		ctx.ShowPlaceholder("Enter password:")
+		ac.step = stepSource
+		ctx.ShowPlaceholder("Password from? (stored/command/env/netrc/oauth2, empty for stored):")
 		return false
 
-	case 1:
+	case stepSource:
+		source := strings.ToLower(strings.TrimSpace(input))
+		if source == "" {
+			source = credentials.SourceStored
+		}
+		if !credentials.Valid(source) {
+			ctx.ShowPlaceholder("Please answer stored, command, env, netrc or oauth2:")
+			return false
+		}
+		ac.source = source
+
+		switch source {
+		case credentials.SourceCommand:
+			ac.step = stepSecret
+			ctx.ShowPlaceholder("Command printing the password (e.g. pass show mail/work):")
+		case credentials.SourceEnv:
+			ac.step = stepSecret
+			ctx.ShowPlaceholder("Environment variable holding the password:")
+		case credentials.SourceNetrc:
+			// looked up by host and login, nothing to ask
+			ac.step = stepHost
+			ctx.ShowPlaceholder("Enter IMAP host (e.g. imap.gmail.com):")
+		case credentials.SourceOAuth2:
+			ac.step = stepOAuthTokenURL
+			ctx.ShowPlaceholder("OAuth token endpoint (e.g. https://oauth2.googleapis.com/token):")
+		default:
+			ac.step = stepSecret
+			ctx.ShowPlaceholder("Enter password:")
+		}
+		return false
+
+	case stepSecret:
 		ac.password = input
-		ac.step++
+		ac.step = stepHost
+		ctx.ShowPlaceholder("Enter IMAP host (e.g. imap.gmail.com):")
+		return false
+
+	case stepOAuthTokenURL:
+		ac.oauthTokenURL = strings.TrimSpace(input)
+		ac.step = stepOAuthClientID
+		ctx.ShowPlaceholder("OAuth client ID:")
+		return false
+
+	case stepOAuthClientID:
+		ac.oauthClientID = strings.TrimSpace(input)
+		ac.step = stepOAuthClientSecret
+		ctx.ShowPlaceholder("OAuth client secret (empty if there is none):")
+		return false
+
+	case stepOAuthClientSecret:
+		ac.oauthClientSecret = strings.TrimSpace(input)
+		ac.step = stepOAuthRefreshToken
+		ctx.ShowPlaceholder("OAuth refresh token:")
+		return false
+
+	case stepOAuthRefreshToken:
+		ac.oauthRefreshToken = strings.TrimSpace(input)
+		ac.step = stepHost
 		ctx.ShowPlaceholder("Enter IMAP host (e.g. imap.gmail.com):")
 		return false
 
-	case 2:
+	case stepHost:
 		ac.host = input
-		ac.step++
-		ctx.ShowPlaceholder("Enter IMAP port (e.g. 993):")
+		ac.step = stepSecurity
+		ctx.ShowPlaceholder("IMAP security (tls/starttls/starttls-optional/none, empty for tls):")
 		return false
 
-	case 3:
-		ac.port = input
-        ac.step++
-        ctx.ShowPlaceholder("Use secure connection? (y/n):")
-        return false
+	case stepSecurity:
+		security, ok := parseSecurity(input, models.SecurityTLS)
+		if !ok {
+			ctx.ShowPlaceholder("Please answer tls, starttls, starttls-optional or none:")
+			return false
+		}
+		ac.security = security
+		ac.step = stepPort
+		ctx.ShowPlaceholder("Enter IMAP port (empty for " + imap.DefaultPort(security) + "):")
+		return false
 
-	case 4:
-		lower := strings.ToLower(strings.TrimSpace(input))
-		ac.secure = lower == "y" || lower == "yes" || lower == "true"
-
-		account := models.Account{
-			Email:     ac.email,
-			Password:  ac.password,
-			Host:      ac.host,
-			Port:      ac.port,
-			Secure:    ac.secure,
+	case stepPort:
+		ac.port = strings.TrimSpace(input)
+		if ac.port == "" {
+			ac.port = imap.DefaultPort(ac.security)
 		}
+		ac.step = stepSMTPHost
+		ctx.ShowPlaceholder("Enter SMTP host (e.g. smtp.gmail.com, empty to skip):")
+		return false
 
-		if err := db.DB.Create(&account).Error; err != nil {
-			ctx.ShowMessage("Failed to create account: " + err.Error())
-			return true
+	case stepSMTPHost:
+		ac.smtpHost = strings.TrimSpace(input)
+		if ac.smtpHost == "" {
+			return ac.finish(ctx)
 		}
+		ac.step = stepSMTPSecurity
+		ctx.ShowPlaceholder("SMTP security (tls/starttls/starttls-optional/none, empty for starttls):")
+		return false
 
-		ctx.ShowMessage("Account added successfully!")
-		ctx.ShowPlaceholder("")
+	case stepSMTPSecurity:
+		security, ok := parseSecurity(input, models.SecuritySTARTTLS)
+		if !ok {
+			ctx.ShowPlaceholder("Please answer tls, starttls, starttls-optional or none:")
+			return false
+		}
+		ac.smtpSecurity = security
+		ac.step = stepSMTPPort
+		ctx.ShowPlaceholder("Enter SMTP port (empty for " + smtp.DefaultPort(security) + "):")
+		return false
+
+	case stepSMTPPort:
+		ac.smtpPort = strings.TrimSpace(input)
+		if ac.smtpPort == "" {
+			ac.smtpPort = smtp.DefaultPort(ac.smtpSecurity)
+		}
+		return ac.finish(ctx)
+
+	case stepAllowPlaintext:
+		lower := strings.ToLower(strings.TrimSpace(input))
+		ac.allowPlaintext = lower == "y" || lower == "yes" || lower == "true"
+		return ac.create(ctx)
+	}
+
+	return true
+}
+
+// parseSecurity reads a security mode answer, empty picks def
+func parseSecurity(input, def string) (string, bool) {
+	switch security := strings.ToLower(strings.TrimSpace(input)); security {
+	case "":
+		return def, true
+	case "ssl":
+		return models.SecurityTLS, true
+	case models.SecurityTLS, models.SecuritySTARTTLS, models.SecuritySTARTTLSOptional, models.SecurityNone:
+		return security, true
+	default:
+		return "", false
+	}
+}
+
+// finish asks about plain text logins when one of the servers may be unencrypted, then creates the account
+func (ac *AddAccount) finish(ctx Context) bool {
+	mayBePlaintext := func(security string) bool {
+		return security == models.SecurityNone || security == models.SecuritySTARTTLSOptional
+	}
+
+	if mayBePlaintext(ac.security) || (ac.smtpHost != "" && mayBePlaintext(ac.smtpSecurity)) {
+		ac.step = stepAllowPlaintext
+		ctx.ShowPlaceholder("The connection may be unencrypted, send the password in plain text anyway? (y/n):")
+		return false
+	}
+
+	return ac.create(ctx)
+}
+
+func (ac *AddAccount) create(ctx Context) bool {
+	account := models.Account{
+		Email:              ac.email,
+		Host:               ac.host,
+		Port:               ac.port,
+		Security:           ac.security,
+		SMTPHost:           ac.smtpHost,
+		SMTPPort:           ac.smtpPort,
+		SMTPSecurity:       ac.smtpSecurity,
+		AllowPlaintextAuth: ac.allowPlaintext,
+		CredentialSource:   ac.source,
+		OAuthTokenURL:      ac.oauthTokenURL,
+		OAuthClientID:      ac.oauthClientID,
+		OAuthClientSecret:  ac.oauthClientSecret,
+		OAuthRefreshToken:  ac.oauthRefreshToken,
+	}
+
+	// only a stored password goes into the DB, the other sources just remember where to look
+	if ac.source == credentials.SourceStored {
+		account.Password = ac.password
+	} else {
+		account.CredentialRef = ac.password
+	}
+
+	if err := db.DB.Create(&account).Error; err != nil {
+		ctx.ShowMessage("Failed to create account: " + err.Error())
 		return true
 	}
 
+	// the watcher only knows the accounts it started with
+	watcher.Restart(account.ID)
+
+	ctx.ShowMessage("Account added successfully!")
+	ctx.ShowPlaceholder("")
 	return true
 }
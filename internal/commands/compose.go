@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vky5/mailcat/internal/compose"
+	"github.com/vky5/mailcat/internal/db"
+	"github.com/vky5/mailcat/internal/db/models"
+)
+
+// ComposeCommand starts a new message from one of the accounts
+type ComposeCommand struct {
+	accounts []models.Account
+	open     func(d compose.Draft)
+}
+
+func NewComposeCommand(open func(d compose.Draft)) *ComposeCommand {
+	return &ComposeCommand{open: open}
+}
+
+func (c *ComposeCommand) Name() string {
+	return "!compose"
+}
+
+func (c *ComposeCommand) Description() string {
+	return "Write a new email"
+}
+
+func (c *ComposeCommand) Begin(ctx Context) {
+	c.accounts = nil
+	if err := db.DB.Find(&c.accounts).Error; err != nil {
+		ctx.ShowMessage("[red]Failed to load accounts: " + err.Error())
+		ctx.ShowPlaceholder("Press Enter to close")
+		return
+	}
+
+	if len(c.accounts) == 0 {
+		ctx.ShowMessage("No accounts yet, add one with !addaccount")
+		ctx.ShowPlaceholder("Press Enter to close")
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("[yellow]Send from:[-] ")
+	for i, acc := range c.accounts {
+		fmt.Fprintf(&b, " %d. %s ", i+1, acc.Email)
+	}
+	ctx.ShowMessage(b.String())
+	ctx.ShowPlaceholder("Account number (empty for 1):")
+}
+
+func (c *ComposeCommand) HandleInput(input string, ctx Context) bool {
+	if len(c.accounts) == 0 {
+		ctx.ShowPlaceholder("")
+		return true
+	}
+
+	n := 1
+	if input = strings.TrimSpace(input); input != "" {
+		var err error
+		n, err = strconv.Atoi(input)
+		if err != nil || n < 1 || n > len(c.accounts) {
+			ctx.ShowPlaceholder(fmt.Sprintf("Enter a number from 1 to %d:", len(c.accounts)))
+			return false
+		}
+	}
+
+	acc := c.accounts[n-1]
+	ctx.ShowPlaceholder("")
+	ctx.ShowMessage("Writing from " + acc.Email)
+	c.open(compose.Draft{AccountID: acc.ID})
+	return true
+}
@@ -0,0 +1,88 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vky5/mailcat/internal/compose"
+	"github.com/vky5/mailcat/internal/db"
+	"github.com/vky5/mailcat/internal/db/models"
+)
+
+// DraftsCommand lists the locally saved drafts and reopens or deletes one of them.
+// opening is done by the UI, so it is injected in the constructor
+type DraftsCommand struct {
+	drafts []models.Draft
+	open   func(d compose.Draft)
+}
+
+func NewDraftsCommand(open func(d compose.Draft)) *DraftsCommand {
+	return &DraftsCommand{open: open}
+}
+
+func (c *DraftsCommand) Name() string {
+	return "!drafts"
+}
+
+func (c *DraftsCommand) Description() string {
+	return "Resume or delete a saved draft"
+}
+
+func (c *DraftsCommand) Begin(ctx Context) {
+	drafts, err := db.GetDrafts()
+	if err != nil {
+		ctx.ShowMessage("[red]Failed to load drafts: " + err.Error())
+		ctx.ShowPlaceholder("Press Enter to close")
+		return
+	}
+	c.drafts = drafts
+
+	if len(drafts) == 0 {
+		ctx.ShowMessage("No saved drafts")
+		ctx.ShowPlaceholder("Press Enter to close")
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("[yellow]Drafts:[-] ")
+	for i, d := range drafts {
+		subject := d.Subject
+		if subject == "" {
+			subject = "(no subject)"
+		}
+		fmt.Fprintf(&b, " %d. %s → %s (%s) ", i+1, subject, d.To, d.UpdatedAt.Format("Jan 2 15:04"))
+	}
+	ctx.ShowMessage(b.String())
+	ctx.ShowPlaceholder("Draft number to open, d<number> to delete, empty to cancel:")
+}
+
+func (c *DraftsCommand) HandleInput(input string, ctx Context) bool {
+	input = strings.TrimSpace(input)
+	if input == "" || len(c.drafts) == 0 {
+		ctx.ShowPlaceholder("")
+		return true
+	}
+
+	remove := strings.HasPrefix(input, "d")
+	n, err := strconv.Atoi(strings.TrimPrefix(input, "d"))
+	if err != nil || n < 1 || n > len(c.drafts) {
+		ctx.ShowPlaceholder(fmt.Sprintf("Enter a number from 1 to %d:", len(c.drafts)))
+		return false
+	}
+	draft := c.drafts[n-1]
+
+	ctx.ShowPlaceholder("")
+	if remove {
+		if err := db.DeleteDraft(draft.ID); err != nil {
+			ctx.ShowMessage("[red]Failed to delete draft: " + err.Error())
+			return true
+		}
+		ctx.ShowMessage("Draft deleted")
+		return true
+	}
+
+	ctx.ShowMessage("Editing draft: " + draft.Subject)
+	c.open(compose.FromSaved(draft))
+	return true
+}
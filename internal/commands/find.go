@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"github.com/vky5/mailcat/internal/search"
+)
+
+// FindCommand searches the cached mail, so it works without a connection. best matches first
+type FindCommand struct {
+	run func(q search.Query, input string) // runs the search and shows the results, provided by the UI
+}
+
+func NewFindCommand(run func(q search.Query, input string)) *FindCommand {
+	return &FindCommand{run: run}
+}
+
+func (c *FindCommand) Name() string {
+	return "!find"
+}
+
+func (c *FindCommand) Description() string {
+	return "Search cached mail, works offline"
+}
+
+func (c *FindCommand) Begin(ctx Context) {
+	ctx.ShowMessage("[yellow]Keys:[-] from: to: cc: subject: body: since: before: on: is:unread is:starred has:attachment in:all, - negates, \"quotes\" keep spaces")
+	ctx.ShowPlaceholder("Find (e.g. from:alice invoice since:2025-01-01):")
+}
+
+func (c *FindCommand) HandleInput(input string, ctx Context) bool {
+	if input == "" {
+		ctx.ShowMessage("Find cancelled")
+		ctx.ShowPlaceholder("")
+		return true
+	}
+
+	q, err := search.Parse(input)
+	if err != nil {
+		ctx.ShowMessage("[red]" + err.Error())
+		ctx.ShowPlaceholder("Find:")
+		return false
+	}
+
+	ctx.ShowPlaceholder("")
+	c.run(q, input)
+	return true
+}
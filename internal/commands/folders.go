@@ -0,0 +1,279 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap/client"
+	"github.com/vky5/mailcat/internal/db"
+	"github.com/vky5/mailcat/internal/db/models"
+	"github.com/vky5/mailcat/internal/imap"
+	"github.com/vky5/mailcat/internal/watcher"
+)
+
+// FolderOp runs fn on a connection of acc in the background, then reloads the account's folders
+// and shows done. the UI provides it, fn may be nil to only reload
+type FolderOp func(acc models.Account, done string, fn func(conn *client.Client) error)
+
+// FolderCommand is one of the folder management commands: pick an account, answer the prompts, run the change
+type FolderCommand struct {
+	name, description string
+	prompts           []string
+
+	// turns the answers into the change, an error means nothing is run
+	change func(acc models.Account, answers []string) (done string, fn func(conn *client.Client) error, err error)
+	op     FolderOp
+
+	accounts []models.Account
+	acc      *models.Account
+	answers  []string
+}
+
+func (c *FolderCommand) Name() string {
+	return c.name
+}
+
+func (c *FolderCommand) Description() string {
+	return c.description
+}
+
+func (c *FolderCommand) Begin(ctx Context) {
+	c.accounts, c.acc, c.answers = nil, nil, nil
+	if err := db.DB.Find(&c.accounts).Error; err != nil {
+		ctx.ShowMessage("[red]Failed to load accounts: " + err.Error())
+		ctx.ShowPlaceholder("Press Enter to close")
+		return
+	}
+
+	if len(c.accounts) == 0 {
+		ctx.ShowMessage("No accounts yet, add one with !addaccount")
+		ctx.ShowPlaceholder("Press Enter to close")
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("[yellow]Account:[-] ")
+	for i, acc := range c.accounts {
+		fmt.Fprintf(&b, " %d. %s ", i+1, acc.Email)
+	}
+	ctx.ShowMessage(b.String())
+	ctx.ShowPlaceholder("Account number (empty for 1):")
+}
+
+func (c *FolderCommand) HandleInput(input string, ctx Context) bool {
+	if len(c.accounts) == 0 {
+		ctx.ShowPlaceholder("")
+		return true
+	}
+
+	input = strings.TrimSpace(input)
+
+	if c.acc == nil {
+		n := 1
+		if input != "" {
+			var err error
+			n, err = strconv.Atoi(input)
+			if err != nil || n < 1 || n > len(c.accounts) {
+				ctx.ShowPlaceholder(fmt.Sprintf("Enter a number from 1 to %d:", len(c.accounts)))
+				return false
+			}
+		}
+		c.acc = &c.accounts[n-1]
+	} else {
+		if input == "" {
+			ctx.ShowPlaceholder(c.prompts[len(c.answers)])
+			return false
+		}
+		c.answers = append(c.answers, input)
+	}
+
+	if len(c.answers) < len(c.prompts) {
+		ctx.ShowPlaceholder(c.prompts[len(c.answers)])
+		return false
+	}
+
+	ctx.ShowPlaceholder("")
+	done, fn, err := c.change(*c.acc, c.answers)
+	if err != nil {
+		ctx.ShowMessage("[red]" + err.Error())
+		return true
+	}
+
+	ctx.ShowMessage("Working on " + c.acc.Email + "...")
+	c.op(*c.acc, done, fn)
+	return true
+}
+
+// NewMkFolderCommand creates a folder
+func NewMkFolderCommand(op FolderOp) *FolderCommand {
+	return &FolderCommand{
+		name:        "!mkfolder",
+		description: "Create a folder",
+		prompts:     []string{"Name of the new folder (e.g. Work/Invoices):"},
+		op:          op,
+		change: func(acc models.Account, answers []string) (string, func(conn *client.Client) error, error) {
+			name := answers[0]
+			return "Created " + name, func(conn *client.Client) error {
+				if err := imap.CreateMailbox(conn, name); err != nil {
+					return err
+				}
+				// most servers subscribe new folders on their own, not all do
+				return imap.Subscribe(conn, name)
+			}, nil
+		},
+	}
+}
+
+// NewRmFolderCommand deletes a folder and its mail, after asking again
+func NewRmFolderCommand(op FolderOp) *FolderCommand {
+	return &FolderCommand{
+		name:        "!rmfolder",
+		description: "Delete a folder and all mail in it",
+		prompts:     []string{"Folder to delete:", "Delete it with all its mail? Type yes to confirm:"},
+		op:          op,
+		change: func(acc models.Account, answers []string) (string, func(conn *client.Client) error, error) {
+			name := answers[0]
+			if !strings.EqualFold(answers[1], "yes") {
+				return "", nil, fmt.Errorf("not deleted, %s stays", name)
+			}
+			if strings.EqualFold(name, "INBOX") {
+				return "", nil, fmt.Errorf("INBOX can't be deleted")
+			}
+
+			return "Deleted " + name, func(conn *client.Client) error {
+				if err := imap.DeleteMailbox(conn, name); err != nil {
+					return err
+				}
+				if err := db.DeleteMailbox(acc.ID, name); err != nil {
+					return err
+				}
+				// subfolders survive a DELETE, only the folder itself stops being watched
+				return renameWatched(acc.ID, name, "", "")
+			}, nil
+		},
+	}
+}
+
+// NewMvFolderCommand renames a folder, which can also move it under another parent
+func NewMvFolderCommand(op FolderOp) *FolderCommand {
+	return &FolderCommand{
+		name:        "!mvfolder",
+		description: "Rename or move a folder",
+		prompts:     []string{"Folder to rename:", "New name:"},
+		op:          op,
+		change: func(acc models.Account, answers []string) (string, func(conn *client.Client) error, error) {
+			from, to := answers[0], answers[1]
+			return "Renamed " + from + " to " + to, func(conn *client.Client) error {
+				delimiter, err := imap.Delimiter(conn)
+				if err != nil {
+					return err
+				}
+				if err := imap.RenameMailbox(conn, from, to); err != nil {
+					return err
+				}
+				// keep the cache, it's the same mail under another name
+				if err := db.RenameMailbox(acc.ID, from, to, delimiter); err != nil {
+					return err
+				}
+				return renameWatched(acc.ID, from, to, delimiter)
+			}, nil
+		},
+	}
+}
+
+// NewSubscribeCommand subscribes to a folder
+func NewSubscribeCommand(op FolderOp) *FolderCommand {
+	return &FolderCommand{
+		name:        "!subscribe",
+		description: "Subscribe to a folder",
+		prompts:     []string{"Folder to subscribe to:"},
+		op:          op,
+		change: func(acc models.Account, answers []string) (string, func(conn *client.Client) error, error) {
+			name := answers[0]
+			return "Subscribed to " + name, func(conn *client.Client) error {
+				return imap.Subscribe(conn, name)
+			}, nil
+		},
+	}
+}
+
+// NewUnsubscribeCommand unsubscribes from a folder, the folder and its mail stay on the server
+func NewUnsubscribeCommand(op FolderOp) *FolderCommand {
+	return &FolderCommand{
+		name:        "!unsubscribe",
+		description: "Unsubscribe from a folder",
+		prompts:     []string{"Folder to unsubscribe from:"},
+		op:          op,
+		change: func(acc models.Account, answers []string) (string, func(conn *client.Client) error, error) {
+			name := answers[0]
+			return "Unsubscribed from " + name, func(conn *client.Client) error {
+				return imap.Unsubscribe(conn, name)
+			}, nil
+		},
+	}
+}
+
+// NewSubscribedCommand switches an account between listing all folders and only the subscribed ones
+func NewSubscribedCommand(op FolderOp) *FolderCommand {
+	return &FolderCommand{
+		name:        "!subscribed",
+		description: "Toggle showing only subscribed folders",
+		op:          op,
+		change: func(acc models.Account, _ []string) (string, func(conn *client.Client) error, error) {
+			acc.SubscribedOnly = !acc.SubscribedOnly
+			if err := db.DB.Model(&acc).Update("SubscribedOnly", acc.SubscribedOnly).Error; err != nil {
+				return "", nil, fmt.Errorf("failed to save setting: %w", err)
+			}
+
+			if acc.SubscribedOnly {
+				return "Showing subscribed folders of " + acc.Email, nil, nil
+			}
+			return "Showing all folders of " + acc.Email, nil, nil
+		},
+	}
+}
+
+// renameWatched points the configured watch folders of an account at a renamed folder and its subfolders,
+// to == "" drops the folder instead. the watcher restarts when anything changed
+func renameWatched(accountID uint, from, to, delimiter string) error {
+	var acc models.Account
+	if err := db.DB.First(&acc, accountID).Error; err != nil {
+		return fmt.Errorf("failed to load account: %w", err)
+	}
+
+	var folders []string
+	changed := false
+	for _, f := range strings.Split(acc.WatchFolders, ",") {
+		f = strings.TrimSpace(f)
+		switch {
+		case f == "":
+			continue
+		case f == from:
+			f = to
+		case delimiter != "" && strings.HasPrefix(f, from+delimiter):
+			if to != "" {
+				f = to + delimiter + strings.TrimPrefix(f, from+delimiter)
+			} else {
+				f = ""
+			}
+		default:
+			folders = append(folders, f)
+			continue
+		}
+
+		changed = true
+		if f != "" {
+			folders = append(folders, f)
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	if err := db.DB.Model(&acc).Update("WatchFolders", strings.Join(folders, ",")).Error; err != nil {
+		return fmt.Errorf("failed to update watched folders: %w", err)
+	}
+	watcher.Restart(acc.ID)
+	return nil
+}
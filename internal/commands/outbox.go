@@ -0,0 +1,93 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vky5/mailcat/internal/db"
+	"github.com/vky5/mailcat/internal/db/models"
+	"github.com/vky5/mailcat/internal/outbox"
+)
+
+// OutboxCommand lists the messages waiting to be sent and retries or cancels them
+type OutboxCommand struct {
+	msgs []models.OutboxMessage
+}
+
+func NewOutboxCommand() *OutboxCommand {
+	return &OutboxCommand{}
+}
+
+func (c *OutboxCommand) Name() string {
+	return "!outbox"
+}
+
+func (c *OutboxCommand) Description() string {
+	return "List, retry or cancel messages waiting to be sent"
+}
+
+func (c *OutboxCommand) Begin(ctx Context) {
+	msgs, err := db.GetOutbox()
+	if err != nil {
+		ctx.ShowMessage("[red]Failed to load outbox: " + err.Error())
+		ctx.ShowPlaceholder("Press Enter to close")
+		return
+	}
+	c.msgs = msgs
+
+	if len(msgs) == 0 {
+		ctx.ShowMessage("Outbox is empty")
+		ctx.ShowPlaceholder("Press Enter to close")
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("[yellow]Outbox:[-] ")
+	for i, m := range msgs {
+		state := fmt.Sprintf("next try %s", m.NextAttempt.Format(time.Kitchen))
+		switch m.Status {
+		case models.OutboxFailed:
+			state = "[red]failed[-]"
+		case models.OutboxSending:
+			state = "sending now"
+		}
+		fmt.Fprintf(&b, " %d. %s → %s (%s, %d attempts: %s) ", i+1, m.Subject, m.Recipients, state, m.Attempts, m.LastError)
+	}
+	ctx.ShowMessage(b.String())
+	ctx.ShowPlaceholder("r<number> to retry, c<number> to cancel, empty to close:")
+}
+
+func (c *OutboxCommand) HandleInput(input string, ctx Context) bool {
+	input = strings.TrimSpace(input)
+	if input == "" || len(c.msgs) == 0 {
+		ctx.ShowPlaceholder("")
+		return true
+	}
+
+	action := input[:1]
+	n, err := strconv.Atoi(input[1:])
+	if (action != "r" && action != "c") || err != nil || n < 1 || n > len(c.msgs) {
+		ctx.ShowPlaceholder(fmt.Sprintf("r<1-%d> to retry, c<1-%d> to cancel:", len(c.msgs), len(c.msgs)))
+		return false
+	}
+	msg := c.msgs[n-1]
+
+	ctx.ShowPlaceholder("")
+	if action == "c" {
+		if err := outbox.Cancel(msg.ID); err != nil {
+			ctx.ShowMessage("[red]Failed to cancel: " + err.Error())
+			return true
+		}
+		ctx.ShowMessage("Cancelled: " + msg.Subject)
+		return true
+	}
+
+	if err := outbox.Retry(msg.ID); err != nil {
+		ctx.ShowMessage("[red]Failed to retry: " + err.Error())
+		return true
+	}
+	ctx.ShowMessage("Retrying: " + msg.Subject)
+	return true
+}
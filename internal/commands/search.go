@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"github.com/vky5/mailcat/internal/search"
+)
+
+// SearchCommand asks the server for mail matching a query, in the open folder or in all of them (in:all)
+type SearchCommand struct {
+	run func(q search.Query, input string) // runs the search and shows the results, provided by the UI
+}
+
+func NewSearchCommand(run func(q search.Query, input string)) *SearchCommand {
+	return &SearchCommand{run: run}
+}
+
+func (c *SearchCommand) Name() string {
+	return "!search"
+}
+
+func (c *SearchCommand) Description() string {
+	return "Search mail on the server"
+}
+
+func (c *SearchCommand) Begin(ctx Context) {
+	ctx.ShowMessage("[yellow]Keys:[-] from: to: cc: subject: body: since: before: on: is:unread is:starred has:attachment larger: smaller: in:all, - negates, \"quotes\" keep spaces")
+	ctx.ShowPlaceholder("Search (e.g. from:alice subject:invoice since:2025-01-01 unread):")
+}
+
+func (c *SearchCommand) HandleInput(input string, ctx Context) bool {
+	if input == "" {
+		ctx.ShowMessage("Search cancelled")
+		ctx.ShowPlaceholder("")
+		return true
+	}
+
+	q, err := search.Parse(input)
+	if err != nil {
+		ctx.ShowMessage("[red]" + err.Error())
+		ctx.ShowPlaceholder("Search:")
+		return false
+	}
+
+	ctx.ShowPlaceholder("")
+	c.run(q, input)
+	return true
+}
@@ -0,0 +1,186 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap/client"
+	"github.com/vky5/mailcat/internal/db"
+	"github.com/vky5/mailcat/internal/db/models"
+	"github.com/vky5/mailcat/internal/tlsutil"
+)
+
+// the questions asked by !tls, in order
+const (
+	tlsStepAccount = iota
+	tlsStepCAFile
+	tlsStepPin
+	tlsStepClientCert
+	tlsStepClientKey
+	tlsStepMinVersion
+)
+
+// TLSCommand sets the CA bundle, certificate pin, client certificate and minimum TLS version of an account
+type TLSCommand struct {
+	step     int
+	accounts []models.Account
+	acc      models.Account
+}
+
+func NewTLSCommand() *TLSCommand {
+	return &TLSCommand{}
+}
+
+func (c *TLSCommand) Name() string {
+	return "!tls"
+}
+
+func (c *TLSCommand) Description() string {
+	return "Set CA bundle, certificate pin and client certificate of an account"
+}
+
+func (c *TLSCommand) Begin(ctx Context) {
+	*c = TLSCommand{}
+	if err := db.DB.Find(&c.accounts).Error; err != nil {
+		ctx.ShowMessage("[red]Failed to load accounts: " + err.Error())
+		ctx.ShowPlaceholder("Press Enter to close")
+		return
+	}
+
+	if len(c.accounts) == 0 {
+		ctx.ShowMessage("No accounts yet, add one with !addaccount")
+		ctx.ShowPlaceholder("Press Enter to close")
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("[yellow]Account:[-] ")
+	for i, acc := range c.accounts {
+		fmt.Fprintf(&b, " %d. %s ", i+1, acc.Email)
+	}
+	ctx.ShowMessage(b.String())
+	ctx.ShowPlaceholder("Account number (empty for 1):")
+}
+
+func (c *TLSCommand) HandleInput(input string, ctx Context) bool {
+	if len(c.accounts) == 0 {
+		ctx.ShowPlaceholder("")
+		return true
+	}
+
+	switch c.step {
+
+	case tlsStepAccount:
+		n := 1
+		if input = strings.TrimSpace(input); input != "" {
+			var err error
+			n, err = strconv.Atoi(input)
+			if err != nil || n < 1 || n > len(c.accounts) {
+				ctx.ShowPlaceholder(fmt.Sprintf("Enter a number from 1 to %d:", len(c.accounts)))
+				return false
+			}
+		}
+		c.acc = c.accounts[n-1]
+		c.step = tlsStepCAFile
+		ctx.ShowMessage("Empty keeps the current value, - clears it")
+		ctx.ShowPlaceholder("CA bundle (PEM file)" + current(c.acc.TLSCAFile) + ":")
+		return false
+
+	case tlsStepCAFile:
+		c.acc.TLSCAFile = answer(input, c.acc.TLSCAFile)
+		c.step = tlsStepPin
+		ctx.ShowPlaceholder("Pinned SHA-256 of the server certificate" + current(c.acc.TLSPinSHA256) + ":")
+		return false
+
+	case tlsStepPin:
+		c.acc.TLSPinSHA256 = answer(input, c.acc.TLSPinSHA256)
+		c.step = tlsStepClientCert
+		ctx.ShowPlaceholder("Client certificate (PEM file)" + current(c.acc.TLSClientCert) + ":")
+		return false
+
+	case tlsStepClientCert:
+		c.acc.TLSClientCert = answer(input, c.acc.TLSClientCert)
+		c.step = tlsStepClientKey
+		ctx.ShowPlaceholder("Client certificate key (PEM file)" + current(c.acc.TLSClientKey) + ":")
+		return false
+
+	case tlsStepClientKey:
+		c.acc.TLSClientKey = answer(input, c.acc.TLSClientKey)
+		c.step = tlsStepMinVersion
+		ctx.ShowPlaceholder("Minimum TLS version (1.2/1.3)" + current(c.acc.TLSMinVersion) + ":")
+		return false
+
+	case tlsStepMinVersion:
+		c.acc.TLSMinVersion = answer(input, c.acc.TLSMinVersion)
+
+		// catch unreadable files and typos now rather than on the next connect
+		if _, err := tlsutil.Config(c.acc, c.acc.Host); err != nil {
+			ctx.ShowMessage("[red]Not saved: " + err.Error())
+			ctx.ShowPlaceholder("")
+			return true
+		}
+
+		err := db.DB.Model(&c.acc).
+			Select("TLSCAFile", "TLSPinSHA256", "TLSClientCert", "TLSClientKey", "TLSMinVersion").
+			Updates(&c.acc).Error
+		if err != nil {
+			ctx.ShowMessage("[red]Failed to save TLS settings: " + err.Error())
+		} else {
+			ctx.ShowMessage("TLS settings saved for " + c.acc.Email + ", used from the next connection")
+		}
+		ctx.ShowPlaceholder("")
+		return true
+	}
+
+	return true
+}
+
+// answer applies an edit: empty keeps the old value, "-" clears it
+func answer(input, old string) string {
+	switch input = strings.TrimSpace(input); input {
+	case "":
+		return old
+	case "-":
+		return ""
+	default:
+		return input
+	}
+}
+
+func current(value string) string {
+	if value == "" {
+		return ""
+	}
+	return " [" + value + "]"
+}
+
+// NewPlaintextCommand sets whether an account may send its password over an unencrypted connection.
+// accounts migrated from the old secure=false setting start without it and need this once
+func NewPlaintextCommand(op FolderOp) *FolderCommand {
+	return &FolderCommand{
+		name:        "!plaintext",
+		description: "Allow or refuse sending the password unencrypted",
+		prompts:     []string{"Send the password in plain text when the connection isn't encrypted? (y/n):"},
+		op:          op,
+		change: func(acc models.Account, answers []string) (string, func(conn *client.Client) error, error) {
+			switch strings.ToLower(answers[0]) {
+			case "y", "yes":
+				acc.AllowPlaintextAuth = true
+			case "n", "no":
+				acc.AllowPlaintextAuth = false
+			default:
+				return "", nil, fmt.Errorf("answer y or n, nothing changed")
+			}
+
+			if err := db.DB.Model(&acc).Update("AllowPlaintextAuth", acc.AllowPlaintextAuth).Error; err != nil {
+				return "", nil, fmt.Errorf("failed to save setting: %w", err)
+			}
+
+			if acc.AllowPlaintextAuth {
+				return "Plain text login allowed for " + acc.Email, nil, nil
+			}
+			return "Plain text login refused for " + acc.Email, nil, nil
+		},
+	}
+}
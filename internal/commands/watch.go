@@ -0,0 +1,95 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vky5/mailcat/internal/db"
+	"github.com/vky5/mailcat/internal/db/models"
+	"github.com/vky5/mailcat/internal/watcher"
+)
+
+// WatchCommand sets which folders of an account are checked for new mail in the background
+type WatchCommand struct {
+	accounts []models.Account
+	acc      *models.Account
+}
+
+func NewWatchCommand() *WatchCommand {
+	return &WatchCommand{}
+}
+
+func (c *WatchCommand) Name() string {
+	return "!watch"
+}
+
+func (c *WatchCommand) Description() string {
+	return "Choose the folders watched for new mail"
+}
+
+func (c *WatchCommand) Begin(ctx Context) {
+	*c = WatchCommand{}
+	if err := db.DB.Find(&c.accounts).Error; err != nil {
+		ctx.ShowMessage("[red]Failed to load accounts: " + err.Error())
+		ctx.ShowPlaceholder("Press Enter to close")
+		return
+	}
+
+	if len(c.accounts) == 0 {
+		ctx.ShowMessage("No accounts yet, add one with !addaccount")
+		ctx.ShowPlaceholder("Press Enter to close")
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("[yellow]Watching:[-] ")
+	for i, acc := range c.accounts {
+		fmt.Fprintf(&b, " %d. %s (%s) ", i+1, acc.Email, strings.Join(watcher.Folders(acc), ", "))
+	}
+	ctx.ShowMessage(b.String())
+	ctx.ShowPlaceholder("Account number (empty for 1):")
+}
+
+func (c *WatchCommand) HandleInput(input string, ctx Context) bool {
+	if len(c.accounts) == 0 {
+		ctx.ShowPlaceholder("")
+		return true
+	}
+
+	// second answer: the folders
+	if c.acc != nil {
+		var folders []string
+		for _, f := range strings.Split(input, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				folders = append(folders, f)
+			}
+		}
+
+		c.acc.WatchFolders = strings.Join(folders, ",")
+		if err := db.DB.Model(c.acc).Update("WatchFolders", c.acc.WatchFolders).Error; err != nil {
+			ctx.ShowMessage("[red]Failed to save folders: " + err.Error())
+			ctx.ShowPlaceholder("")
+			return true
+		}
+
+		watcher.Restart(c.acc.ID)
+		ctx.ShowMessage("Watching " + strings.Join(watcher.Folders(*c.acc), ", ") + " of " + c.acc.Email)
+		ctx.ShowPlaceholder("")
+		return true
+	}
+
+	n := 1
+	if input = strings.TrimSpace(input); input != "" {
+		var err error
+		n, err = strconv.Atoi(input)
+		if err != nil || n < 1 || n > len(c.accounts) {
+			ctx.ShowPlaceholder(fmt.Sprintf("Enter a number from 1 to %d:", len(c.accounts)))
+			return false
+		}
+	}
+
+	c.acc = &c.accounts[n-1]
+	ctx.ShowPlaceholder("Folders to watch, comma separated (empty for INBOX):")
+	return false
+}
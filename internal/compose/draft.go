@@ -0,0 +1,118 @@
+package compose
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vky5/mailcat/internal/db/models"
+)
+
+// Draft is a message being written, before it gets rendered and sent
+type Draft struct {
+	ID         uint // local draft row, 0 until the draft is saved
+	AccountID  uint
+	To         string
+	Cc         string
+	Bcc        string
+	Subject    string
+	Body       string
+	InReplyTo  string // Message-ID of the message replied to
+	References string // space separated Message-IDs of the thread so far
+	MessageID  string // set once the draft is saved, kept when it is sent
+}
+
+// Reply builds a draft answering e: sender as recipient, "Re:" subject, quoted body and threading headers
+func Reply(e models.Email) Draft {
+	return Draft{
+		AccountID:  e.AccountID,
+		To:         e.From,
+		Subject:    prefixSubject("Re:", e.Subject),
+		Body:       "\n\n" + quote(e),
+		InReplyTo:  e.MessageID,
+		References: references(e),
+	}
+}
+
+// Forward builds a draft passing e on to someone else, with the original headers and body inline
+func Forward(e models.Email) Draft {
+	var b strings.Builder
+	b.WriteString("\n\n---------- Forwarded message ----------\n")
+	b.WriteString("From: " + e.From + "\n")
+	b.WriteString("Date: " + e.Date.Format("Mon, Jan 2, 2006 at 3:04 PM") + "\n")
+	b.WriteString("Subject: " + e.Subject + "\n")
+	if e.To != "" {
+		b.WriteString("To: " + e.To + "\n")
+	}
+	b.WriteString("\n")
+	b.WriteString(strings.TrimSpace(e.Body))
+	b.WriteString("\n")
+
+	return Draft{
+		AccountID:  e.AccountID,
+		Subject:    prefixSubject("Fwd:", e.Subject),
+		Body:       b.String(),
+		References: references(e),
+	}
+}
+
+// FromEmail reopens a draft stored on the server (e.g. one saved by another client).
+// saving it again replaces the server copy since the Message-ID stays the same
+func FromEmail(e models.Email) Draft {
+	return Draft{
+		AccountID:  e.AccountID,
+		To:         e.To,
+		Cc:         e.Cc,
+		Subject:    e.Subject,
+		Body:       e.Body,
+		InReplyTo:  e.InReplyTo,
+		References: e.References,
+		MessageID:  e.MessageID,
+	}
+}
+
+// prefixSubject adds "Re:" / "Fwd:" unless the subject already carries it
+func prefixSubject(prefix, subject string) string {
+	subject = strings.TrimSpace(subject)
+
+	aliases := []string{strings.ToLower(prefix)}
+	if prefix == "Fwd:" {
+		aliases = append(aliases, "fw:")
+	}
+	for _, a := range aliases {
+		if strings.HasPrefix(strings.ToLower(subject), a) {
+			return subject
+		}
+	}
+
+	return prefix + " " + subject
+}
+
+// quote renders the "On ..., X wrote:" attribution and the body with "> " in front of every line
+func quote(e models.Email) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("On %s, %s wrote:\n", e.Date.Format("Mon, Jan 2, 2006 at 3:04 PM"), e.From))
+
+	for _, line := range strings.Split(strings.TrimSpace(e.Body), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, ">") {
+			b.WriteString(">" + line + "\n")
+		} else {
+			b.WriteString("> " + line + "\n")
+		}
+	}
+
+	return b.String()
+}
+
+// references extends the References chain of e with its own Message-ID (RFC 5322 3.6.4)
+func references(e models.Email) string {
+	refs := strings.Fields(e.References)
+	if len(refs) == 0 && e.InReplyTo != "" {
+		refs = strings.Fields(e.InReplyTo)
+	}
+	if e.MessageID != "" {
+		refs = append(refs, e.MessageID)
+	}
+
+	return strings.Join(refs, " ")
+}
@@ -0,0 +1,143 @@
+package compose
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/emersion/go-imap/client"
+	"github.com/vky5/mailcat/internal/db"
+	"github.com/vky5/mailcat/internal/db/models"
+	"github.com/vky5/mailcat/internal/imap"
+	"github.com/vky5/mailcat/internal/outbox"
+	"github.com/vky5/mailcat/internal/smtp"
+)
+
+// Message turns the draft into an outgoing message sent by from
+func (d Draft) Message(from string) *smtp.Message {
+	return &smtp.Message{
+		From:       from,
+		To:         []string{d.To},
+		Cc:         []string{d.Cc},
+		Bcc:        []string{d.Bcc},
+		Subject:    d.Subject,
+		Body:       d.Body,
+		MessageID:  d.MessageID,
+		InReplyTo:  d.InReplyTo,
+		References: d.References,
+	}
+}
+
+// Send submits the draft through the SMTP server of its account.
+// when the server can't be reached it waits in the outbox instead and queued is true.
+// either way the local copy of a saved draft is no longer needed
+func Send(d Draft) (queued bool, err error) {
+	acc, err := loadAccount(d.AccountID)
+	if err != nil {
+		return false, err
+	}
+
+	msg := d.Message(acc.Email)
+	rcpts, err := msg.Recipients()
+	if err != nil {
+		return false, err
+	}
+	raw, err := msg.Bytes()
+	if err != nil {
+		return false, err
+	}
+
+	queued, err = outbox.Send(&models.OutboxMessage{
+		AccountID:  acc.ID,
+		Subject:    d.Subject,
+		From:       acc.Email,
+		Recipients: strings.Join(rcpts, ","),
+		Raw:        raw,
+		MessageID:  d.MessageID,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if d.ID != 0 {
+		if err := db.DeleteDraft(d.ID); err != nil {
+			log.Println("Failed to remove sent draft:", err)
+		}
+	}
+
+	return queued, nil
+}
+
+// Save stores the draft locally, d.ID and d.MessageID are set the first time
+func Save(d *Draft) error {
+	if d.MessageID == "" {
+		acc, err := loadAccount(d.AccountID)
+		if err != nil {
+			return err
+		}
+		d.MessageID = smtp.NewMessageID(acc.Email)
+	}
+
+	row := models.Draft{
+		ID:         d.ID,
+		AccountID:  d.AccountID,
+		To:         d.To,
+		Cc:         d.Cc,
+		Bcc:        d.Bcc,
+		Subject:    d.Subject,
+		Body:       d.Body,
+		InReplyTo:  d.InReplyTo,
+		References: d.References,
+		MessageID:  d.MessageID,
+	}
+
+	if err := db.SaveDraft(&row); err != nil {
+		return fmt.Errorf("failed to save draft: %v", err)
+	}
+
+	d.ID = row.ID
+	return nil
+}
+
+// Upload APPENDs the draft to the server's Drafts mailbox, replacing the version stored before.
+// call it after Save so the draft has its Message-ID
+func Upload(d Draft) error {
+	acc, err := loadAccount(d.AccountID)
+	if err != nil {
+		return err
+	}
+
+	// Bcc only lives in the local copy, it must never show up in a header
+	raw, err := d.Message(acc.Email).Bytes()
+	if err != nil {
+		return err
+	}
+
+	return imap.Do(*acc, func(conn *client.Client) error {
+		return imap.SaveDraft(conn, d.MessageID, raw)
+	})
+}
+
+// FromSaved turns a stored draft back into one that can be edited
+func FromSaved(row models.Draft) Draft {
+	return Draft{
+		ID:         row.ID,
+		AccountID:  row.AccountID,
+		To:         row.To,
+		Cc:         row.Cc,
+		Bcc:        row.Bcc,
+		Subject:    row.Subject,
+		Body:       row.Body,
+		InReplyTo:  row.InReplyTo,
+		References: row.References,
+		MessageID:  row.MessageID,
+	}
+}
+
+func loadAccount(id uint) (*models.Account, error) {
+	var acc models.Account
+	if err := db.DB.First(&acc, id).Error; err != nil {
+		return nil, fmt.Errorf("failed to load account: %v", err)
+	}
+	return &acc, nil
+}
@@ -0,0 +1,41 @@
+package credentials
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/vky5/mailcat/internal/db/models"
+)
+
+// commandProvider runs CredentialRef through the shell and uses the first line it prints
+type commandProvider struct{}
+
+func (commandProvider) Password(acc models.Account, _ string) (string, error) {
+	if strings.TrimSpace(acc.CredentialRef) == "" {
+		return "", fmt.Errorf("no password command configured")
+	}
+
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(shell, "-c", acc.CredentialRef)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%q failed: %v %s", acc.CredentialRef, err, strings.TrimSpace(stderr.String()))
+	}
+
+	// pass and friends put the password on the first line, metadata may follow
+	line, _, _ := strings.Cut(string(out), "\n")
+	line = strings.TrimRight(line, "\r")
+	if line == "" {
+		return "", fmt.Errorf("%q printed nothing", acc.CredentialRef)
+	}
+	return line, nil
+}
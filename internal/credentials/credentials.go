@@ -0,0 +1,60 @@
+package credentials
+
+import (
+	"fmt"
+
+	"github.com/vky5/mailcat/internal/db/models"
+)
+
+// where an account's password comes from
+const (
+	SourceStored  = "stored"  // Account.Password, encrypted in the DB
+	SourceCommand = "command" // stdout of a shell command, e.g. `pass show mail/work`
+	SourceEnv     = "env"     // an environment variable
+	SourceNetrc   = "netrc"   // ~/.netrc (or $NETRC), matched on host and login
+	SourceOAuth2  = "oauth2"  // access token from the account's refresh token
+)
+
+// Provider fetches the password an account uses to log in to host
+type Provider interface {
+	Password(acc models.Account, host string) (string, error)
+}
+
+var providers = map[string]Provider{
+	SourceStored:  storedProvider{},
+	SourceCommand: commandProvider{},
+	SourceEnv:     envProvider{},
+	SourceNetrc:   netrcProvider{},
+	SourceOAuth2:  oauthProvider{},
+}
+
+// Lookup returns the password of acc for host (the IMAP or the SMTP server)
+func Lookup(acc models.Account, host string) (string, error) {
+	source := acc.CredentialSource
+	if source == "" {
+		source = SourceStored
+	}
+
+	p, ok := providers[source]
+	if !ok {
+		return "", fmt.Errorf("unknown credential source %q", source)
+	}
+
+	pass, err := p.Password(acc, host)
+	if err != nil {
+		return "", fmt.Errorf("failed to get password from %s: %v", source, err)
+	}
+	return pass, nil
+}
+
+// Valid reports whether source is one of the known credential sources
+func Valid(source string) bool {
+	_, ok := providers[source]
+	return ok
+}
+
+type storedProvider struct{}
+
+func (storedProvider) Password(acc models.Account, _ string) (string, error) {
+	return acc.Password, nil
+}
@@ -0,0 +1,23 @@
+package credentials
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/vky5/mailcat/internal/db/models"
+)
+
+// envProvider reads the password from the environment variable named in CredentialRef
+type envProvider struct{}
+
+func (envProvider) Password(acc models.Account, _ string) (string, error) {
+	if acc.CredentialRef == "" {
+		return "", fmt.Errorf("no environment variable configured")
+	}
+
+	pass, ok := os.LookupEnv(acc.CredentialRef)
+	if !ok || pass == "" {
+		return "", fmt.Errorf("$%s is not set", acc.CredentialRef)
+	}
+	return pass, nil
+}
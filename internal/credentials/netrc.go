@@ -0,0 +1,116 @@
+package credentials
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vky5/mailcat/internal/db/models"
+)
+
+// netrcProvider looks the account up in ~/.netrc, $NETRC overrides the path.
+// the entry for the exact host wins, then the IMAP host, then a default entry
+type netrcProvider struct{}
+
+type netrcEntry struct {
+	machine  string // "" for the default entry
+	login    string
+	password string
+}
+
+func (netrcProvider) Password(acc models.Account, host string) (string, error) {
+	path, err := netrcPath()
+	if err != nil {
+		return "", err
+	}
+
+	entries, err := parseNetrc(path)
+	if err != nil {
+		return "", err
+	}
+
+	for _, machine := range []string{host, acc.Host, ""} {
+		for _, e := range entries {
+			if e.machine == machine && (e.login == "" || e.login == acc.Email) && e.password != "" {
+				return e.password, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("no entry for %s in %s", acc.Email, path)
+}
+
+func netrcPath() (string, error) {
+	if path := os.Getenv("NETRC"); path != "" {
+		return path, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".netrc"), nil
+}
+
+// parseNetrc reads machine/default entries. macdef bodies run until the next blank line and are skipped
+func parseNetrc(path string) ([]netrcEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []netrcEntry
+	cur := -1 // index into entries, appends may move the backing array
+	inMacro := false
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if inMacro {
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			next := func() string {
+				if i+1 < len(fields) {
+					i++
+					return fields[i]
+				}
+				return ""
+			}
+
+			switch fields[i] {
+			case "machine":
+				entries = append(entries, netrcEntry{machine: next()})
+				cur = len(entries) - 1
+			case "default":
+				entries = append(entries, netrcEntry{})
+				cur = len(entries) - 1
+			case "login":
+				if v := next(); cur >= 0 {
+					entries[cur].login = v
+				}
+			case "password":
+				if v := next(); cur >= 0 {
+					entries[cur].password = v
+				}
+			case "account":
+				next()
+			case "macdef":
+				next()
+				inMacro = true
+				i = len(fields)
+			}
+		}
+	}
+
+	return entries, scanner.Err()
+}
@@ -0,0 +1,19 @@
+package credentials
+
+import (
+	"github.com/vky5/mailcat/internal/db/models"
+	"github.com/vky5/mailcat/internal/oauth"
+)
+
+// oauthProvider hands out an OAuth2 access token instead of a password,
+// callers check UsesOAuth to log in with XOAUTH2/OAUTHBEARER rather than LOGIN
+type oauthProvider struct{}
+
+func (oauthProvider) Password(acc models.Account, _ string) (string, error) {
+	return oauth.AccessToken(acc)
+}
+
+// UsesOAuth reports whether Lookup returns an access token for acc
+func UsesOAuth(acc models.Account) bool {
+	return acc.CredentialSource == SourceOAuth2
+}
@@ -3,8 +3,8 @@ package db
 import (
 	"log"
 
+	"github.com/glebarez/sqlite"
 	"github.com/vky5/mailcat/internal/db/models"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
@@ -18,8 +18,16 @@ func InitDB() {
 		log.Fatalf("failed to connect database: %v", err)
 	}
 
-	err = DB.AutoMigrate(&models.Account{}, &models.Email{}) // automatically creates or updates the database to matches the go struct defined here
+	err = DB.AutoMigrate(&models.Account{}, &models.Email{}, &models.MailboxState{}, &models.Draft{}, &models.OutboxMessage{}, &models.Vault{}) // automatically creates or updates the database to matches the go struct defined here
 	if err != nil {
 		log.Fatalf("failed to migrate models: %v", err)
 	}
+
+	if err := migrateSecureColumn(); err != nil {
+		log.Fatalf("failed to migrate account security: %v", err)
+	}
+
+	if err := initSearch(); err != nil {
+		log.Fatalf("failed to set up search index: %v", err)
+	}
 }
@@ -0,0 +1,20 @@
+package db
+
+import "github.com/vky5/mailcat/internal/db/models"
+
+// SaveDraft creates or updates a local draft, a new draft gets its ID filled in
+func SaveDraft(draft *models.Draft) error {
+	return DB.Save(draft).Error
+}
+
+// GetDrafts returns every local draft, last edited first
+func GetDrafts() ([]models.Draft, error) {
+	var drafts []models.Draft
+	err := DB.Order("updated_at DESC").Find(&drafts).Error
+	return drafts, err
+}
+
+// DeleteDraft removes a local draft, once it was sent or thrown away
+func DeleteDraft(id uint) error {
+	return DB.Delete(&models.Draft{}, id).Error
+}
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"github.com/vky5/mailcat/internal/db/models"
+	"gorm.io/gorm/clause"
+)
+
+// SaveEmails upserts fetched messages into the local cache.
+// rows are matched on (account, mailbox, uid) so refetching the same page only refreshes them
+func SaveEmails(accountID uint, mailbox string, emails []models.Email) error {
+	if len(emails) == 0 {
+		return nil
+	}
+
+	for i := range emails {
+		emails[i].AccountID = accountID
+		emails[i].Mailbox = mailbox
+	}
+
+	return DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "account_id"}, {Name: "mailbox"}, {Name: "uid"}},
+		DoUpdates: clause.AssignmentColumns(append([]string{
+			"uid_validity", "message_id", "in_reply_to", "references",
+			"from", "to", "cc", "subject", "body", "date", "attachments",
+		}, flagColumns...)),
+	}).Create(&emails).Error
+}
+
+// GetEmails returns cached messages of a mailbox, newest first
+func GetEmails(accountID uint, mailbox string, limit int) ([]models.Email, error) {
+	var emails []models.Email
+	err := DB.Where("account_id = ? AND mailbox = ?", accountID, mailbox).
+		Order("date DESC, uid DESC").
+		Limit(limit).
+		Find(&emails).Error
+
+	return emails, err
+}
+
+// flagColumns are the Email columns that mirror IMAP flags
+var flagColumns = []string{"read", "starred", "answered", "draft", "deleted"}
+
+// GetEmailFlags returns the UID and flag columns of every cached message in a mailbox
+func GetEmailFlags(accountID uint, mailbox string) ([]models.Email, error) {
+	var emails []models.Email
+	err := DB.Select(append([]string{"uid"}, flagColumns...)).
+		Where("account_id = ? AND mailbox = ?", accountID, mailbox).
+		Find(&emails).Error
+
+	return emails, err
+}
+
+// UpdateEmailFlags writes the flag columns of e back to the cached row with the same UID
+func UpdateEmailFlags(accountID uint, mailbox string, e models.Email) error {
+	return DB.Model(&models.Email{}).
+		Where("account_id = ? AND mailbox = ? AND uid = ?", accountID, mailbox, e.UID).
+		Select(flagColumns).
+		Updates(&e).Error
+}
+
+// UpdateEmailFlag sets a single flag column of the cached row with this UID, leaving the others alone
+func UpdateEmailFlag(accountID uint, mailbox string, uid uint32, column string, on bool) error {
+	return DB.Model(&models.Email{}).
+		Where("account_id = ? AND mailbox = ? AND uid = ?", accountID, mailbox, uid).
+		Update(column, on).Error
+}
+
+// DeleteEmailsByUID drops cached messages that no longer exist on the server
+func DeleteEmailsByUID(accountID uint, mailbox string, uids []uint32) error {
+	if len(uids) == 0 {
+		return nil
+	}
+
+	return DB.Where("account_id = ? AND mailbox = ? AND uid IN ?", accountID, mailbox, uids).
+		Delete(&models.Email{}).Error
+}
+
+// DeleteMailboxEmails wipes the whole cached copy of a mailbox
+func DeleteMailboxEmails(accountID uint, mailbox string) error {
+	return DB.Where("account_id = ? AND mailbox = ?", accountID, mailbox).
+		Delete(&models.Email{}).Error
+}
+
+// GetEmailsByUID returns the cached messages of a mailbox with the given UIDs, newest first
+func GetEmailsByUID(accountID uint, mailbox string, uids []uint32) ([]models.Email, error) {
+	var emails []models.Email
+	if len(uids) == 0 {
+		return emails, nil
+	}
+
+	err := DB.Where("account_id = ? AND mailbox = ? AND uid IN ?", accountID, mailbox, uids).
+		Order("date DESC, uid DESC").
+		Find(&emails).Error
+
+	return emails, err
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"unicode/utf8"
+
+	"github.com/vky5/mailcat/internal/db/models"
+	"gorm.io/gorm"
+)
+
+// GetMailboxState returns the stored sync state of a mailbox.
+// a mailbox that was never synced comes back zeroed (UIDValidity 0)
+func GetMailboxState(accountID uint, mailbox string) (*models.MailboxState, error) {
+	state := models.MailboxState{AccountID: accountID, Mailbox: mailbox}
+	err := DB.Where("account_id = ? AND mailbox = ?", accountID, mailbox).
+		FirstOrInit(&state).Error
+
+	return &state, err
+}
+
+// SaveMailboxState creates or updates the sync state of a mailbox
+func SaveMailboxState(state *models.MailboxState) error {
+	return DB.Save(state).Error
+}
+
+// RenameMailbox moves the cached messages and sync state of a renamed folder, and of its subfolders, to the new name
+func RenameMailbox(accountID uint, from, to, delimiter string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&models.Email{}, &models.MailboxState{}} {
+			err := tx.Model(model).
+				Where("account_id = ? AND mailbox = ?", accountID, from).
+				Update("mailbox", to).Error
+			if err != nil {
+				return err
+			}
+
+			if delimiter == "" {
+				continue
+			}
+			// substr counts characters, not bytes. LIKE ignores ASCII case, the substr comparison doesn't
+			prefix := from + delimiter
+			chars := utf8.RuneCountInString(prefix)
+			err = tx.Model(model).
+				Where("account_id = ? AND mailbox LIKE ? ESCAPE '\\' AND substr(mailbox, 1, ?) = ?",
+					accountID, likeEscaper.Replace(prefix)+"%", chars, prefix).
+				Update("mailbox", gorm.Expr("? || substr(mailbox, ?)", to+delimiter, chars+1)).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteMailbox forgets a deleted folder: its cached messages and its sync state
+func DeleteMailbox(accountID uint, mailbox string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("account_id = ? AND mailbox = ?", accountID, mailbox).Delete(&models.Email{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("account_id = ? AND mailbox = ?", accountID, mailbox).Delete(&models.MailboxState{}).Error
+	})
+}
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/vky5/mailcat/internal/db/models"
+)
+
+func TestRenameMailbox(t *testing.T) {
+	useSearchDB(t)
+	if err := DB.AutoMigrate(&models.MailboxState{}); err != nil {
+		t.Fatal(err)
+	}
+
+	folders := []string{"Entwürfe", "Entwürfe/2024", "Entwürfe/2024/Q1", "entwürfe/other", "Entwürfe_x/y", "INBOX"}
+	for i, f := range folders {
+		if err := DB.Create(&models.Email{AccountID: 1, Mailbox: f, UID: uint32(i + 1)}).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := DB.Create(&models.MailboxState{AccountID: 1, Mailbox: f}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := RenameMailbox(1, "Entwürfe", "Ärchiv/Entwürfe", "/"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Entwürfe_x/y, INBOX, entwürfe/other, Ärchiv/Entwürfe, Ärchiv/Entwürfe/2024, Ärchiv/Entwürfe/2024/Q1"
+	for _, model := range []interface{}{&models.Email{}, &models.MailboxState{}} {
+		var names []string
+		if err := DB.Model(model).Where("account_id = ?", 1).Pluck("mailbox", &names).Error; err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(names)
+		if got := strings.Join(names, ", "); got != want {
+			t.Errorf("%T mailboxes after rename:\n got %s\nwant %s", model, got, want)
+		}
+	}
+}
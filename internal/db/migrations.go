@@ -0,0 +1,34 @@
+package db
+
+import (
+	"log"
+
+	"github.com/vky5/mailcat/internal/db/models"
+)
+
+// migrateSecureColumn replaces the old accounts.secure bool with the security mode.
+// secure=false meant a plain text connection. those accounts keep it, but sending the password
+// in plain text is left for the user to allow (!plaintext), until then login is refused
+func migrateSecureColumn() error {
+	migrator := DB.Migrator()
+	if !migrator.HasColumn(&models.Account{}, "secure") {
+		return nil
+	}
+
+	err := DB.Exec(`UPDATE accounts SET
+		security = CASE WHEN secure THEN ? ELSE ? END,
+		allow_plaintext_auth = CASE WHEN secure THEN allow_plaintext_auth ELSE 0 END
+		WHERE security IS NULL OR security = ''`,
+		models.SecurityTLS, models.SecurityNone).Error
+	if err != nil {
+		return err
+	}
+
+	// gorm's DropColumn quietly skips columns the struct doesn't know anymore
+	if err := DB.Exec("ALTER TABLE accounts DROP COLUMN secure").Error; err != nil {
+		return err
+	}
+
+	log.Println("Migrated accounts.secure to accounts.security")
+	return nil
+}
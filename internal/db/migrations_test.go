@@ -0,0 +1,61 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/vky5/mailcat/internal/db/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMigrateSecureColumn(t *testing.T) {
+	conn, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := DB
+	DB = conn
+	t.Cleanup(func() { DB = old })
+
+	// the accounts table as an older version left it
+	if err := DB.AutoMigrate(&models.Account{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := DB.Exec("ALTER TABLE accounts ADD COLUMN secure numeric").Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range []struct {
+		email  string
+		secure bool
+	}{{"tls@example.org", true}, {"plain@example.org", false}} {
+		err := DB.Exec("INSERT INTO accounts (email, security, allow_plaintext_auth, secure) VALUES (?, '', 0, ?)", row.email, row.secure).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := migrateSecureColumn(); err != nil {
+		t.Fatal(err)
+	}
+	if DB.Migrator().HasColumn(&models.Account{}, "secure") {
+		t.Error("secure column is still there")
+	}
+
+	var accounts []models.Account
+	if err := DB.Order("email").Find(&accounts).Error; err != nil {
+		t.Fatal(err)
+	}
+	plain, secure := accounts[0], accounts[1]
+
+	if secure.Security != models.SecurityTLS || secure.AllowPlaintextAuth {
+		t.Errorf("secure account migrated to %q, plain text allowed %v", secure.Security, secure.AllowPlaintextAuth)
+	}
+	// still unencrypted, but the password only goes out once the user allows it
+	if plain.Security != models.SecurityNone || plain.AllowPlaintextAuth {
+		t.Errorf("insecure account migrated to %q, plain text allowed %v", plain.Security, plain.AllowPlaintextAuth)
+	}
+}
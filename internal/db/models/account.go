@@ -1,15 +1,100 @@
 package models
 
-import "time"
+import (
+	"time"
 
+	"github.com/vky5/mailcat/internal/secrets"
+	"gorm.io/gorm"
+)
+
+// connection security modes
+const (
+	SecurityTLS              = "tls"               // implicit TLS from the first byte
+	SecuritySTARTTLS         = "starttls"          // plain text connection upgraded with STARTTLS, fails without it
+	SecuritySTARTTLSOptional = "starttls-optional" // STARTTLS when the server offers it, plain text otherwise
+	SecurityNone             = "none"              // plain text, nothing encrypted
+)
 
 // account credentials for IMAP
 type Account struct {
 	ID        uint   `gorm:"primaryKey"`
 	Email     string `gorm:"uniqueIndex"`
-	Password  string
-	Secure    bool
+	Password  string // encrypted in the DB, plain text in memory (see the hooks below)
+	Security  string // IMAP connection security, one of the Security* modes (empty means tls)
 	Host      string
 	Port      string
 	CreatedAt time.Time
+
+	// outgoing server, logs in with the same email/password as IMAP
+	SMTPHost     string
+	SMTPPort     string
+	SMTPSecurity string // one of the Security* modes
+
+	// credentials only go over an unencrypted connection when this is set
+	AllowPlaintextAuth bool
+
+	// folders checked for new mail in the background, comma separated (empty means INBOX)
+	WatchFolders string
+
+	// the folder panel only lists subscribed folders (LSUB)
+	SubscribedOnly bool
+
+	// TLS trust, shared by IMAP and SMTP (see the tlsutil package)
+	TLSCAFile     string // PEM bundle of extra CAs
+	TLSPinSHA256  string // hex SHA-256 of the server certificate
+	TLSClientCert string // PEM client certificate path
+	TLSClientKey  string // PEM key of the client certificate
+	TLSMinVersion string // "1.2", "1.3"...
+
+	// where the password comes from when it isn't stored here, see the credentials package
+	CredentialSource string // "stored" (or empty), "command", "env", "netrc" or "oauth2"
+	CredentialRef    string // the command to run or the variable to read
+
+	// OAuth2 refresh token flow, used when CredentialSource is "oauth2"
+	OAuthTokenURL     string
+	OAuthClientID     string
+	OAuthClientSecret string // encrypted like the password
+	OAuthRefreshToken string // encrypted like the password
+}
+
+// secretFields are the columns encrypted at rest
+func (a *Account) secretFields() []*string {
+	return []*string{&a.Password, &a.OAuthClientSecret, &a.OAuthRefreshToken}
+}
+
+// BeforeSave encrypts the secrets on their way into the DB
+func (a *Account) BeforeSave(tx *gorm.DB) error {
+	for _, field := range a.secretFields() {
+		if *field == "" || secrets.IsEncrypted(*field) {
+			continue
+		}
+
+		enc, err := secrets.Encrypt(*field)
+		if err != nil {
+			return err
+		}
+		*field = enc
+	}
+	return nil
+}
+
+// AfterSave puts the plain text secrets back so the saved struct stays usable
+func (a *Account) AfterSave(tx *gorm.DB) error {
+	return a.decryptSecrets()
+}
+
+// AfterFind decrypts the secrets of every loaded account
+func (a *Account) AfterFind(tx *gorm.DB) error {
+	return a.decryptSecrets()
+}
+
+func (a *Account) decryptSecrets() error {
+	for _, field := range a.secretFields() {
+		plain, err := secrets.Decrypt(*field)
+		if err != nil {
+			return err
+		}
+		*field = plain
+	}
+	return nil
 }
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Draft is an unsent message kept locally so it can be picked up again with !drafts
+type Draft struct {
+	ID         uint `gorm:"primaryKey"`
+	AccountID  uint `gorm:"index"`
+	To         string
+	Cc         string
+	Bcc        string
+	Subject    string
+	Body       string
+	InReplyTo  string
+	References string
+	MessageID  string // also identifies the copy in the server's Drafts mailbox
+	UpdatedAt  time.Time
+}
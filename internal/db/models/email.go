@@ -2,13 +2,26 @@ package models
 
 import "time"
 
+// Email is a cached message, keyed by account, mailbox and IMAP UID
 type Email struct {
-	ID          uint `gorm:"primaryKey"`
+	ID          uint   `gorm:"primaryKey"`
+	AccountID   uint   `gorm:"uniqueIndex:idx_email_key"`
+	Mailbox     string `gorm:"uniqueIndex:idx_email_key"`
+	UID         uint32 `gorm:"uniqueIndex:idx_email_key"`
+	UIDValidity uint32
+	MessageID   string // threading headers, used for replies
+	InReplyTo   string
+	References  string
 	From        string
 	To          string
+	Cc          string
 	Subject     string
 	Body        string
-	Date        time.Time
-	Read        bool
+	Date        time.Time `gorm:"index"`
+	Read        bool      // \Seen
+	Starred     bool      // \Flagged
+	Answered    bool      // \Answered
+	Draft       bool      // \Draft
+	Deleted     bool      // \Deleted, still there until the mailbox is expunged
 	Attachments string
 }
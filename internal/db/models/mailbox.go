@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// MailboxState remembers where the last sync of a mailbox stopped
+type MailboxState struct {
+	ID          uint   `gorm:"primaryKey"`
+	AccountID   uint   `gorm:"uniqueIndex:idx_mailbox_state"`
+	Mailbox     string `gorm:"uniqueIndex:idx_mailbox_state"`
+	UIDValidity uint32 // cache is only valid while this matches the server
+	UIDNext     uint32 // every UID below this has already been seen
+	// HIGHESTMODSEQ at the last sync, 0 when the server has no CONDSTORE
+	HighestModSeq uint64
+	LastSync      time.Time
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// outbox message states
+const (
+	OutboxQueued  = "queued"  // waiting for the next attempt
+	OutboxSending = "sending" // claimed by the worker, an attempt is running
+	OutboxFailed  = "failed"  // the server refused it, only retried by hand
+)
+
+// OutboxMessage is a rendered message waiting to be submitted over SMTP
+type OutboxMessage struct {
+	ID          uint `gorm:"primaryKey"`
+	AccountID   uint `gorm:"index"`
+	Subject     string
+	From        string
+	Recipients  string // comma separated envelope recipients, Bcc included
+	Raw         []byte // the RFC 5322 message exactly as it will be sent
+	MessageID   string // draft copy to remove from the server once sent
+	Status      string `gorm:"index"`
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string
+	CreatedAt   time.Time
+}
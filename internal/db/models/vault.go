@@ -0,0 +1,9 @@
+package models
+
+// Vault holds what is needed to check the master passphrase, there is at most one row.
+// the key itself is never stored, it is derived from the passphrase on every start
+type Vault struct {
+	ID    uint `gorm:"primaryKey"`
+	Salt  []byte
+	Check string // a known text encrypted with the key
+}
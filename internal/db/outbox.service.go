@@ -0,0 +1,77 @@
+package db
+
+import (
+	"time"
+
+	"github.com/vky5/mailcat/internal/db/models"
+)
+
+// QueueOutbox adds a message to the outbox
+func QueueOutbox(msg *models.OutboxMessage) error {
+	return DB.Create(msg).Error
+}
+
+// GetOutbox returns every message in the outbox, oldest first
+func GetOutbox() ([]models.OutboxMessage, error) {
+	var msgs []models.OutboxMessage
+	err := DB.Order("created_at ASC").Find(&msgs).Error
+	return msgs, err
+}
+
+// GetDueOutbox returns the queued messages whose next attempt is due at now
+func GetDueOutbox(now time.Time) ([]models.OutboxMessage, error) {
+	var msgs []models.OutboxMessage
+	err := DB.Where("status = ? AND next_attempt <= ?", models.OutboxQueued, now).
+		Order("next_attempt ASC").
+		Find(&msgs).Error
+	return msgs, err
+}
+
+// ClaimOutbox marks a queued message as being sent. false when it isn't queued anymore,
+// e.g. cancelled since it was read
+func ClaimOutbox(id uint) (bool, error) {
+	res := DB.Model(&models.OutboxMessage{}).
+		Where("id = ? AND status = ?", id, models.OutboxQueued).
+		Update("status", models.OutboxSending)
+	return res.RowsAffected == 1, res.Error
+}
+
+// FinishOutboxAttempt writes back the state of a claimed message after a failed attempt
+func FinishOutboxAttempt(msg *models.OutboxMessage) error {
+	return DB.Model(&models.OutboxMessage{}).
+		Where("id = ? AND status = ?", msg.ID, models.OutboxSending).
+		Updates(map[string]interface{}{
+			"status":       msg.Status,
+			"attempts":     msg.Attempts,
+			"last_error":   msg.LastError,
+			"next_attempt": msg.NextAttempt,
+		}).Error
+}
+
+// RetryOutbox makes a queued or failed message due at now. false when it is being sent
+// right now or already gone
+func RetryOutbox(id uint, now time.Time) (bool, error) {
+	res := DB.Model(&models.OutboxMessage{}).
+		Where("id = ? AND status IN ?", id, []string{models.OutboxQueued, models.OutboxFailed}).
+		Updates(map[string]interface{}{"status": models.OutboxQueued, "next_attempt": now})
+	return res.RowsAffected == 1, res.Error
+}
+
+// CancelOutbox removes a queued or failed message. false when it is being sent right now or already gone
+func CancelOutbox(id uint) (bool, error) {
+	res := DB.Where("id = ? AND status IN ?", id, []string{models.OutboxQueued, models.OutboxFailed}).
+		Delete(&models.OutboxMessage{})
+	return res.RowsAffected == 1, res.Error
+}
+
+// ReleaseOutbox puts messages claimed by a worker that never finished (the app quit mid attempt) back in the queue
+func ReleaseOutbox() error {
+	return DB.Model(&models.OutboxMessage{}).
+		Where("status = ?", models.OutboxSending).
+		Update("status", models.OutboxQueued).Error
+}
+
+// DeleteOutbox removes a message from the outbox once it is sent
+func DeleteOutbox(id uint) error {
+	return DB.Delete(&models.OutboxMessage{}, id).Error
+}
@@ -0,0 +1,315 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/vky5/mailcat/internal/db/models"
+	"github.com/vky5/mailcat/internal/search"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// markers around the matched words in snippets
+const (
+	HighlightStart = "<mark>"
+	HighlightEnd   = "</mark>"
+)
+
+// SearchHit is a cached message matching a local search
+type SearchHit struct {
+	models.Email
+	Snippet string  // matched text with HighlightStart/HighlightEnd around the hits
+	Rank    float64 // lower is better, 0 without full-text search
+}
+
+// ftsEnabled is false when the SQLite library has no FTS5. the bundled driver always has it,
+// the LIKE fallback (no ranking and slower, but the same results) is only a last resort
+var ftsEnabled bool
+
+// the cached emails indexed by subject, from, to, cc and body.
+// an external content table: the text lives in emails only, triggers keep the index in step
+var ftsSchema = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS email_fts USING fts5(
+		subject, "from", "to", cc, body,
+		content='emails', content_rowid='id',
+		tokenize='unicode61 remove_diacritics 2'
+	)`,
+	`CREATE TRIGGER IF NOT EXISTS emails_fts_insert AFTER INSERT ON emails BEGIN
+		INSERT INTO email_fts(rowid, subject, "from", "to", cc, body)
+		VALUES (new.id, new.subject, new."from", new."to", new.cc, new.body);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS emails_fts_delete AFTER DELETE ON emails BEGIN
+		INSERT INTO email_fts(email_fts, rowid, subject, "from", "to", cc, body)
+		VALUES ('delete', old.id, old.subject, old."from", old."to", old.cc, old.body);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS emails_fts_update AFTER UPDATE OF subject, "from", "to", cc, body ON emails BEGIN
+		INSERT INTO email_fts(email_fts, rowid, subject, "from", "to", cc, body)
+		VALUES ('delete', old.id, old.subject, old."from", old."to", old.cc, old.body);
+		INSERT INTO email_fts(rowid, subject, "from", "to", cc, body)
+		VALUES (new.id, new.subject, new."from", new."to", new.cc, new.body);
+	END`,
+}
+
+var ftsTriggers = []string{"emails_fts_insert", "emails_fts_delete", "emails_fts_update"}
+
+// initSearch sets up the full-text index, or the LIKE fallback when FTS5 is missing after all
+func initSearch() error {
+	if err := dropOldIndex(); err != nil {
+		return err
+	}
+
+	var triggers int64
+	err := DB.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'trigger' AND name IN ?", ftsTriggers).
+		Scan(&triggers).Error
+	if err != nil {
+		return err
+	}
+
+	// quiet: "no such module" is expected without FTS5 and handled below
+	quiet := DB.Session(&gorm.Session{Logger: DB.Logger.LogMode(logger.Silent)})
+	err = quiet.Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range ftsSchema {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if !strings.Contains(err.Error(), "no such module") {
+			return err
+		}
+
+		// left over from a build with FTS5 they would break every write to emails
+		for _, name := range ftsTriggers {
+			if err := DB.Exec("DROP TRIGGER IF EXISTS " + name).Error; err != nil {
+				return err
+			}
+		}
+		log.Println("SQLite has no FTS5, local search falls back to LIKE")
+		ftsEnabled = false
+		return nil
+	}
+	ftsEnabled = true
+
+	// new index, or one that missed the writes of a build without FTS5
+	if triggers < int64(len(ftsTriggers)) {
+		if err := DB.Exec("INSERT INTO email_fts(email_fts) VALUES('rebuild')").Error; err != nil {
+			return fmt.Errorf("failed to build search index: %w", err)
+		}
+	}
+	return nil
+}
+
+// dropOldIndex removes an index from before cc was cached, initSearch builds it again with the new columns
+func dropOldIndex() error {
+	var tables, cc int64
+	err := DB.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'email_fts'").Scan(&tables).Error
+	if err != nil || tables == 0 {
+		return err
+	}
+	// no FTS5 in this build, the table can't be looked into
+	if err := DB.Raw("SELECT count(*) FROM pragma_table_info('email_fts') WHERE name = 'cc'").Scan(&cc).Error; err != nil || cc > 0 {
+		return nil
+	}
+
+	for _, name := range ftsTriggers {
+		if err := DB.Exec("DROP TRIGGER IF EXISTS " + name).Error; err != nil {
+			return err
+		}
+	}
+	if err := DB.Exec("DROP TABLE email_fts").Error; err != nil {
+		return fmt.Errorf("failed to drop old search index: %w", err)
+	}
+	log.Println("Rebuilding the search index with Cc")
+	return nil
+}
+
+// SearchCache searches the cached messages, no connection needed.
+// accountID 0 searches every account and mailbox "" every folder, in: in the query overrides mailbox.
+// with FTS5 the best matches come first, otherwise the newest
+func SearchCache(accountID uint, mailbox string, q search.Query, limit int) ([]SearchHit, error) {
+	if q.Larger != 0 || q.Smaller != 0 {
+		return nil, fmt.Errorf("larger: and smaller: only work in server search")
+	}
+	for _, t := range q.Terms {
+		if t.Field == "bcc" {
+			return nil, fmt.Errorf("bcc: isn't part of received mail, only works in server search")
+		}
+	}
+
+	if q.AllFolders {
+		mailbox = ""
+	} else if q.Folder != "" {
+		mailbox = q.Folder
+	}
+
+	var positive, negative []search.Term
+	for _, t := range q.Terms {
+		if t.Not {
+			negative = append(negative, t)
+		} else {
+			positive = append(positive, t)
+		}
+	}
+
+	var hits []SearchHit
+	var err error
+	if ftsEnabled && len(positive) > 0 {
+		hits, err = searchFTS(accountID, mailbox, q, positive, negative, limit)
+	} else {
+		hits, err = searchLike(accountID, mailbox, q, limit)
+		for i := range hits {
+			hits[i].Snippet = likeSnippet(hits[i].Email, positive)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to search cache: %w", err)
+	}
+	return hits, nil
+}
+
+// searchFTS needs at least one positive term, NOT only works between two terms in MATCH
+func searchFTS(accountID uint, mailbox string, q search.Query, positive, negative []search.Term, limit int) ([]SearchHit, error) {
+	var match []string
+	for i, t := range positive {
+		if i > 0 {
+			match = append(match, "AND")
+		}
+		match = append(match, ftsPhrase(t))
+	}
+	for _, t := range negative {
+		match = append(match, "NOT", ftsPhrase(t))
+	}
+
+	// subject matches count most, body matches least
+	tx := DB.Table("email_fts").
+		Select(`emails.*,
+			snippet(email_fts, -1, ?, ?, '…', 12) AS snippet,
+			bm25(email_fts, 10.0, 5.0, 3.0, 3.0, 1.0) AS rank`, HighlightStart, HighlightEnd).
+		Joins("JOIN emails ON emails.id = email_fts.rowid").
+		Where("email_fts MATCH ?", strings.Join(match, " "))
+	tx = searchFilters(tx, accountID, mailbox, q)
+
+	var hits []SearchHit
+	err := tx.Order("rank").Limit(limit).Scan(&hits).Error
+	return hits, err
+}
+
+// ftsPhrase quotes a term for MATCH, the last word matches as a prefix so results show while typing
+func ftsPhrase(t search.Term) string {
+	phrase := `"` + strings.ReplaceAll(t.Value, `"`, `""`) + `"*`
+	if t.Field == "text" {
+		return phrase
+	}
+	return t.Field + " : " + phrase
+}
+
+func searchLike(accountID uint, mailbox string, q search.Query, limit int) ([]SearchHit, error) {
+	tx := DB.Table("emails").Select("emails.*")
+	for _, t := range q.Terms {
+		pattern := "%" + likeEscaper.Replace(t.Value) + "%"
+
+		var cond string
+		var args []interface{}
+		if t.Field == "text" {
+			cond = `(emails.subject LIKE ? ESCAPE '\' OR emails."from" LIKE ? ESCAPE '\' OR emails."to" LIKE ? ESCAPE '\' OR emails.cc LIKE ? ESCAPE '\' OR emails.body LIKE ? ESCAPE '\')`
+			args = []interface{}{pattern, pattern, pattern, pattern, pattern}
+		} else {
+			cond = fmt.Sprintf(`emails.%q LIKE ? ESCAPE '\'`, t.Field)
+			args = []interface{}{pattern}
+		}
+
+		if t.Not {
+			tx = tx.Where("NOT "+cond, args...)
+		} else {
+			tx = tx.Where(cond, args...)
+		}
+	}
+	tx = searchFilters(tx, accountID, mailbox, q)
+
+	var hits []SearchHit
+	err := tx.Order("emails.date DESC").Limit(limit).Scan(&hits).Error
+	return hits, err
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// searchFilters narrows a search down by scope, dates, flags and attachments
+func searchFilters(tx *gorm.DB, accountID uint, mailbox string, q search.Query) *gorm.DB {
+	if accountID != 0 {
+		tx = tx.Where("emails.account_id = ?", accountID)
+	}
+	if mailbox != "" {
+		tx = tx.Where("emails.mailbox = ?", mailbox)
+	}
+
+	if !q.On.IsZero() {
+		tx = tx.Where("emails.date >= ? AND emails.date < ?", q.On, q.On.AddDate(0, 0, 1))
+	}
+	if !q.Since.IsZero() {
+		tx = tx.Where("emails.date >= ?", q.Since)
+	}
+	if !q.Before.IsZero() {
+		tx = tx.Where("emails.date < ?", q.Before)
+	}
+
+	// states are named like the flag columns
+	for state, on := range q.Is {
+		tx = tx.Where("emails."+state+" = ?", on)
+	}
+
+	if has, ok := q.Has["attachment"]; ok {
+		if has {
+			tx = tx.Where("emails.attachments <> ''")
+		} else {
+			tx = tx.Where("emails.attachments = ''")
+		}
+	}
+
+	return tx
+}
+
+// likeSnippet cuts the text around the first hit out of the body (or the subject), like FTS5's snippet()
+func likeSnippet(e models.Email, terms []search.Term) string {
+	const before, after = 30, 60
+
+	for _, text := range []string{e.Body, e.Subject} {
+		lower := strings.ToLower(text)
+		if len(lower) != len(text) {
+			lower = text // offsets must line up, rare letters change length when lowered
+		}
+		for _, t := range terms {
+			i := strings.Index(lower, strings.ToLower(t.Value))
+			if i < 0 {
+				continue
+			}
+			end := i + len(t.Value)
+
+			start, stop := max(0, i-before), min(len(text), end+after)
+			// don't cut a UTF-8 sequence in half
+			for start > 0 && !utf8Start(text[start]) {
+				start--
+			}
+			for stop < len(text) && !utf8Start(text[stop]) {
+				stop++
+			}
+
+			snippet := text[start:i] + HighlightStart + text[i:end] + HighlightEnd + text[end:stop]
+			if start > 0 {
+				snippet = "…" + snippet
+			}
+			if stop < len(text) {
+				snippet += "…"
+			}
+			return strings.Join(strings.Fields(snippet), " ")
+		}
+	}
+	return ""
+}
+
+func utf8Start(b byte) bool {
+	return b&0xC0 != 0x80
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/vky5/mailcat/internal/db/models"
+	"github.com/vky5/mailcat/internal/search"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// useSearchDB points DB at a fresh SQLite file with the emails table and the search index
+func useSearchDB(t *testing.T, emails ...models.Email) {
+	t.Helper()
+
+	conn, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := DB
+	DB = conn
+	t.Cleanup(func() { DB = old })
+
+	if err := DB.AutoMigrate(&models.Email{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := initSearch(); err != nil {
+		t.Fatal(err)
+	}
+	if len(emails) > 0 {
+		if err := DB.Create(&emails).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func find(t *testing.T, query string) []SearchHit {
+	t.Helper()
+
+	q, err := search.Parse(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hits, err := SearchCache(1, "INBOX", q, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hits
+}
+
+func subjects(hits []SearchHit) string {
+	var s []string
+	for _, h := range hits {
+		s = append(s, h.Subject)
+	}
+	return strings.Join(s, ", ")
+}
+
+func TestSearchCacheFullText(t *testing.T) {
+	day := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	useSearchDB(t,
+		models.Email{AccountID: 1, Mailbox: "INBOX", UID: 1, Subject: "Invoice for March", From: "billing@example.org", Body: "please pay", Date: day},
+		models.Email{AccountID: 1, Mailbox: "INBOX", UID: 2, Subject: "Lunch", From: "alice@example.org", Cc: "carol@example.org", Body: "the invoice is attached", Date: day.AddDate(0, 0, 1)},
+		models.Email{AccountID: 1, Mailbox: "INBOX", UID: 3, Subject: "Café crème", From: "bob@example.org", Body: "see you", Date: day.AddDate(0, 0, 2), Read: true},
+		models.Email{AccountID: 1, Mailbox: "Archive", UID: 1, Subject: "Old invoice", Date: day},
+	)
+
+	if !ftsEnabled {
+		t.Fatal("the SQLite driver has no FTS5")
+	}
+
+	// subject hits rank above body hits, other folders stay out
+	if got := subjects(find(t, "invoice")); got != "Invoice for March, Lunch" {
+		t.Errorf("invoice found %q", got)
+	}
+
+	hits := find(t, "subject:inv")
+	if len(hits) != 1 || !strings.Contains(hits[0].Snippet, HighlightStart+"Invoice"+HighlightEnd) {
+		t.Errorf("prefix search = %q, snippet %q", subjects(hits), hits[0].Snippet)
+	}
+
+	if got := subjects(find(t, "cafe")); got != "Café crème" {
+		t.Errorf("diacritics aren't folded: %q", got)
+	}
+	if got := subjects(find(t, "invoice -from:billing")); got != "Lunch" {
+		t.Errorf("negated term found %q", got)
+	}
+	if got := subjects(find(t, "invoice since:2025-03-02")); got != "Lunch" {
+		t.Errorf("since: found %q", got)
+	}
+	if got := subjects(find(t, "is:read see")); got != "Café crème" {
+		t.Errorf("is:read found %q", got)
+	}
+	if got := subjects(find(t, "cc:carol")); got != "Lunch" {
+		t.Errorf("cc: found %q", got)
+	}
+
+	// the triggers keep the index in step with the table
+	if err := DB.Model(&models.Email{}).Where("uid = ? AND mailbox = ?", 2, "INBOX").Update("body", "nothing here").Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := subjects(find(t, "invoice")); got != "Invoice for March" {
+		t.Errorf("after the update invoice found %q", got)
+	}
+}
+
+func TestSearchIndexWithoutCcIsRebuilt(t *testing.T) {
+	useSearchDB(t, models.Email{AccountID: 1, Mailbox: "INBOX", UID: 1, Subject: "Party", Cc: "carol@example.org"})
+
+	// the index as it was before cc was cached
+	for _, name := range ftsTriggers {
+		if err := DB.Exec("DROP TRIGGER " + name).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, stmt := range []string{
+		"DROP TABLE email_fts",
+		`CREATE VIRTUAL TABLE email_fts USING fts5(subject, "from", "to", body, content='emails', content_rowid='id')`,
+		`CREATE TRIGGER emails_fts_insert AFTER INSERT ON emails BEGIN SELECT 1; END`,
+	} {
+		if err := DB.Exec(stmt).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := initSearch(); err != nil {
+		t.Fatal(err)
+	}
+	if got := subjects(find(t, "cc:carol")); got != "Party" {
+		t.Errorf("cc: after the rebuild found %q", got)
+	}
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/vky5/mailcat/internal/db/models"
+	"github.com/vky5/mailcat/internal/secrets"
+)
+
+// HasVault reports whether a master passphrase was set up before
+func HasVault() (bool, error) {
+	var count int64
+	err := DB.Model(&models.Vault{}).Count(&count).Error
+	return count > 0, err
+}
+
+// OpenVault unlocks the stored secrets with passphrase, setting up the vault on the first run.
+// account passwords still stored in plain text are encrypted right after
+func OpenVault(passphrase string) error {
+	// Find instead of First, a missing vault is expected on the first run and not worth a log line
+	var vault models.Vault
+	err := DB.Limit(1).Find(&vault).Error
+
+	switch {
+	case err != nil:
+		return fmt.Errorf("failed to load vault: %v", err)
+	case vault.ID == 0:
+		salt, check, err := secrets.Create(passphrase)
+		if err != nil {
+			return err
+		}
+		vault = models.Vault{Salt: salt, Check: check}
+		if err := DB.Create(&vault).Error; err != nil {
+			return fmt.Errorf("failed to store vault: %v", err)
+		}
+	default:
+		if err := secrets.Unlock(passphrase, vault.Salt, vault.Check); err != nil {
+			return err
+		}
+	}
+
+	return encryptPasswords()
+}
+
+// encryptPasswords migrates rows written before passwords were encrypted
+func encryptPasswords() error {
+	var rows []struct {
+		ID       uint
+		Password string
+	}
+	err := DB.Model(&models.Account{}).
+		Select("id", "password").
+		Where("password <> '' AND password NOT LIKE ?", "enc:%").
+		Scan(&rows).Error
+	if err != nil {
+		return fmt.Errorf("failed to look for plain text passwords: %v", err)
+	}
+
+	for _, row := range rows {
+		enc, err := secrets.Encrypt(row.Password)
+		if err != nil {
+			return err
+		}
+		// UpdateColumn skips the hooks, the value is already encrypted
+		err = DB.Model(&models.Account{}).Where("id = ?", row.ID).UpdateColumn("password", enc).Error
+		if err != nil {
+			return fmt.Errorf("failed to encrypt password of account %d: %v", row.ID, err)
+		}
+	}
+
+	if len(rows) > 0 {
+		log.Printf("Encrypted %d stored password(s)\n", len(rows))
+	}
+	return nil
+}
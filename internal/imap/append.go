@@ -0,0 +1,121 @@
+package imap
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/vky5/mailcat/internal/logger"
+)
+
+// AppendSent stores a copy of a sent message in the Sent mailbox, already marked \Seen
+func AppendSent(conn *client.Client, raw []byte) error {
+	sent, err := FindSpecialMailbox(conn, imap.SentAttr)
+	if err != nil {
+		return err
+	}
+	if sent == "" {
+		return fmt.Errorf("no Sent mailbox found")
+	}
+
+	return appendMessage(conn, sent, []string{imap.SeenFlag}, raw)
+}
+
+// FilesSentMail reports whether the server puts mail submitted over SMTP into Sent by itself,
+// appending a copy there as well would leave every message twice.
+// Gmail is the one that does, it announces its extensions with X-GM-EXT-1
+func FilesSentMail(conn *client.Client) bool {
+	ok, _ := conn.Support("X-GM-EXT-1")
+	return ok
+}
+
+// SaveDraft APPENDs a draft to the Drafts mailbox with \Draft.
+// the earlier version of the same draft (same Message-ID) is removed once the new one is stored
+func SaveDraft(conn *client.Client, messageID string, raw []byte) error {
+	drafts, err := FindSpecialMailbox(conn, imap.DraftsAttr)
+	if err != nil {
+		return err
+	}
+	if drafts == "" {
+		return fmt.Errorf("no Drafts mailbox found")
+	}
+
+	// looked up before the APPEND, the search would otherwise find the new copy too
+	var old []uint32
+	if messageID != "" {
+		old, err = findByMessageID(conn, drafts, messageID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := appendMessage(conn, drafts, []string{imap.DraftFlag, imap.SeenFlag}, raw); err != nil {
+		return err
+	}
+
+	if err := removeUIDs(conn, drafts, old); err != nil {
+		logger.Error("Failed to remove old draft version:", err)
+	}
+	return nil
+}
+
+// DeleteDraft removes every copy of a draft from the Drafts mailbox, used once it was sent
+func DeleteDraft(conn *client.Client, messageID string) error {
+	drafts, err := FindSpecialMailbox(conn, imap.DraftsAttr)
+	if err != nil || drafts == "" {
+		return err
+	}
+
+	uids, err := findByMessageID(conn, drafts, messageID)
+	if err != nil {
+		return err
+	}
+
+	return removeUIDs(conn, drafts, uids)
+}
+
+func appendMessage(conn *client.Client, mailbox string, flags []string, raw []byte) error {
+	if err := conn.Append(mailbox, flags, time.Now(), bytes.NewBuffer(raw)); err != nil {
+		return fmt.Errorf("failed to append to %s: %v", mailbox, err)
+	}
+	return nil
+}
+
+// findByMessageID returns the UIDs of the messages in mailbox with the given Message-ID header
+func findByMessageID(conn *client.Client, mailbox, messageID string) ([]uint32, error) {
+	if err := ensureSelected(conn, mailbox); err != nil {
+		return nil, err
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.Header.Add("Message-Id", messageID)
+
+	uids, err := conn.UidSearch(criteria)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search %s: %v", mailbox, err)
+	}
+	return uids, nil
+}
+
+// removeUIDs flags messages \Deleted and expunges them, no Trash detour
+func removeUIDs(conn *client.Client, mailbox string, uids []uint32) error {
+	if len(uids) == 0 {
+		return nil
+	}
+
+	if err := ensureSelected(conn, mailbox); err != nil {
+		return err
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uids...)
+
+	item := imap.FormatFlagsOp(imap.AddFlags, true)
+	if err := conn.UidStore(seqset, item, []interface{}{imap.DeletedFlag}, nil); err != nil {
+		return fmt.Errorf("failed to flag %v in %s as deleted: %v", uids, mailbox, err)
+	}
+
+	return expungeUIDs(conn, seqset)
+}
@@ -0,0 +1,173 @@
+package imap
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-imap/responses"
+	"github.com/vky5/mailcat/internal/logger"
+)
+
+// modSeqMode is how much of RFC 7162 a connection has enabled
+type modSeqMode int
+
+const (
+	modSeqNone      modSeqMode = iota // plain UID diff only
+	modSeqCondstore                   // CHANGEDSINCE works, expunges still need a diff
+	modSeqQresync                     // CHANGEDSINCE + VANISHED, no diff needed at all
+)
+
+const statusHighestModSeq imap.StatusItem = "HIGHESTMODSEQ"
+
+// enabled extensions per connection, filled right after login
+var modSeqModes sync.Map // *client.Client -> modSeqMode
+
+// enableModSeq turns on QRESYNC (or at least CONDSTORE) when the server has it.
+// ENABLE is only valid before a mailbox gets selected, so this runs right after login
+func enableModSeq(conn *client.Client) {
+	mode := modSeqNone
+
+	for _, ext := range []struct {
+		name string
+		mode modSeqMode
+	}{{"QRESYNC", modSeqQresync}, {"CONDSTORE", modSeqCondstore}} {
+		if ok, _ := conn.Support(ext.name); !ok {
+			continue
+		}
+
+		if _, err := conn.Enable([]string{ext.name}); err != nil {
+			logger.Warn("Failed to enable", ext.name, ":", err)
+			continue
+		}
+
+		mode = ext.mode
+		break
+	}
+
+	modSeqModes.Store(conn, mode)
+}
+
+func getModSeqMode(conn *client.Client) modSeqMode {
+	if mode, ok := modSeqModes.Load(conn); ok {
+		return mode.(modSeqMode)
+	}
+	return modSeqNone
+}
+
+// highestModSeq asks the server for the HIGHESTMODSEQ of a mailbox, 0 means the mailbox has none
+func highestModSeq(conn *client.Client, mailbox string) (uint64, error) {
+	status, err := conn.Status(mailbox, []imap.StatusItem{statusHighestModSeq})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get HIGHESTMODSEQ of %s: %v", mailbox, err)
+	}
+
+	raw, ok := status.Items[statusHighestModSeq]
+	if !ok {
+		return 0, nil
+	}
+
+	s, err := imap.ParseString(raw)
+	if err != nil {
+		return 0, fmt.Errorf("bad HIGHESTMODSEQ for %s: %v", mailbox, err)
+	}
+
+	return strconv.ParseUint(s, 10, 64)
+}
+
+// fetchChangedSince is UID FETCH with the CHANGEDSINCE (and optionally VANISHED) modifier
+type fetchChangedSince struct {
+	fetch    commands.Fetch
+	modSeq   uint64
+	vanished bool
+}
+
+func (cmd *fetchChangedSince) Command() *imap.Command {
+	c := cmd.fetch.Command()
+
+	modifiers := []interface{}{
+		imap.RawString("CHANGEDSINCE"),
+		imap.RawString(strconv.FormatUint(cmd.modSeq, 10)),
+	}
+	if cmd.vanished {
+		modifiers = append(modifiers, imap.RawString("VANISHED"))
+	}
+
+	c.Arguments = append(c.Arguments, modifiers)
+	return c
+}
+
+// changesHandler collects the FETCH answers plus any VANISHED (EARLIER) UIDs
+type changesHandler struct {
+	fetch    *responses.Fetch
+	vanished *imap.SeqSet
+}
+
+func (h *changesHandler) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok || name != "VANISHED" {
+		return h.fetch.Handle(resp)
+	}
+
+	// * VANISHED (EARLIER) 41,43:116
+	if len(fields) == 0 {
+		return nil
+	}
+	s, err := imap.ParseString(fields[len(fields)-1])
+	if err != nil {
+		return err
+	}
+	set, err := imap.ParseSeqSet(s)
+	if err != nil {
+		return err
+	}
+
+	h.vanished.AddSet(set)
+	return nil
+}
+
+// fetchChanges returns the flags of every message in the selected mailbox changed after modSeq.
+// with vanished set (QRESYNC only) it also returns the set of UIDs expunged since then
+func fetchChanges(conn *client.Client, modSeq uint64, vanished bool) ([]*imap.Message, *imap.SeqSet, error) {
+	seqset := new(imap.SeqSet)
+	seqset.AddRange(1, 0)
+
+	cmd := &commands.Uid{Cmd: &fetchChangedSince{
+		fetch: commands.Fetch{
+			SeqSet: seqset,
+			Items:  []imap.FetchItem{imap.FetchUid, imap.FetchFlags},
+		},
+		modSeq:   modSeq,
+		vanished: vanished,
+	}}
+
+	messages := make(chan *imap.Message, 50)
+	h := &changesHandler{
+		fetch:    &responses.Fetch{Messages: messages, SeqSet: seqset, Uid: true},
+		vanished: new(imap.SeqSet),
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		status, err := conn.Execute(cmd, h)
+		if err == nil {
+			err = status.Err()
+		}
+		close(messages)
+		done <- err
+	}()
+
+	var changed []*imap.Message
+	for msg := range messages {
+		changed = append(changed, msg)
+	}
+
+	if err := <-done; err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch changes since modseq %d: %v", modSeq, err)
+	}
+
+	return changed, h.vanished, nil
+}
@@ -0,0 +1,384 @@
+package imap
+
+import (
+	"net"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/server"
+	"github.com/glebarez/sqlite"
+	"github.com/vky5/mailcat/internal/db"
+	"github.com/vky5/mailcat/internal/db/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// the memory backend has one INBOX message, UID 6, \Seen. its UIDVALIDITY is always 1
+const (
+	testUID         = 6
+	testUIDValidity = 1
+	testUIDNext     = 7
+)
+
+// modSeqChange is a message the fake server reports as changed at modSeq
+type modSeqChange struct {
+	uid    uint32
+	flags  []string
+	modSeq uint64
+}
+
+// fakeModSeq adds CONDSTORE (and QRESYNC) to the go-imap test server. the memory backend has
+// no mod-sequences, so HIGHESTMODSEQ, the changes and the expunges are scripted by the test
+type fakeModSeq struct {
+	qresync  bool
+	highest  uint64
+	changes  []modSeqChange
+	vanished string // UID set answered as VANISHED (EARLIER)
+
+	mu           sync.Mutex
+	changedSince []uint64 // CHANGEDSINCE of every fetch the client sent
+}
+
+func (f *fakeModSeq) Capabilities(c server.Conn) []string {
+	caps := []string{"ENABLE", "CONDSTORE"}
+	if f.qresync {
+		caps = append(caps, "QRESYNC")
+	}
+	return caps
+}
+
+func (f *fakeModSeq) Command(name string) server.HandlerFactory {
+	switch name {
+	case "ENABLE":
+		return func() server.Handler { return &fakeEnable{} }
+	case "STATUS":
+		return func() server.Handler { return &fakeStatus{f: f} }
+	case "FETCH":
+		return func() server.Handler { return &fakeFetch{f: f} }
+	}
+	return nil
+}
+
+type fakeEnable struct {
+	caps []interface{}
+}
+
+func (h *fakeEnable) Parse(fields []interface{}) error {
+	h.caps = fields
+	return nil
+}
+
+func (h *fakeEnable) Handle(conn server.Conn) error {
+	return conn.WriteResp(imap.NewUntaggedResp(append([]interface{}{imap.RawString("ENABLED")}, h.caps...)))
+}
+
+// fakeStatus answers every STATUS with the scripted HIGHESTMODSEQ only
+type fakeStatus struct {
+	f       *fakeModSeq
+	mailbox interface{}
+}
+
+func (h *fakeStatus) Parse(fields []interface{}) error {
+	h.mailbox = fields[0]
+	return nil
+}
+
+func (h *fakeStatus) Handle(conn server.Conn) error {
+	return conn.WriteResp(imap.NewUntaggedResp([]interface{}{
+		imap.RawString("STATUS"), h.mailbox,
+		[]interface{}{imap.RawString("HIGHESTMODSEQ"), imap.RawString(strconv.FormatUint(h.f.highest, 10))},
+	}))
+}
+
+// fakeFetch answers UID FETCH ... (CHANGEDSINCE n [VANISHED]) from the script,
+// any other fetch goes to the memory backend
+type fakeFetch struct {
+	server.Fetch
+	f            *fakeModSeq
+	changedSince uint64
+	vanished     bool
+}
+
+func (h *fakeFetch) Parse(fields []interface{}) error {
+	if len(fields) > 2 {
+		modifiers, _ := fields[len(fields)-1].([]interface{})
+		for i := 0; i < len(modifiers); i++ {
+			name, _ := imap.ParseString(modifiers[i])
+			switch name {
+			case "CHANGEDSINCE":
+				i++
+				s, _ := imap.ParseString(modifiers[i])
+				h.changedSince, _ = strconv.ParseUint(s, 10, 64)
+			case "VANISHED":
+				h.vanished = true
+			}
+		}
+		fields = fields[:len(fields)-1]
+	}
+	return h.Fetch.Parse(fields)
+}
+
+func (h *fakeFetch) UidHandle(conn server.Conn) error {
+	if h.changedSince == 0 {
+		return h.Fetch.UidHandle(conn)
+	}
+
+	h.f.mu.Lock()
+	h.f.changedSince = append(h.f.changedSince, h.changedSince)
+	h.f.mu.Unlock()
+
+	if h.vanished && h.f.vanished != "" {
+		err := conn.WriteResp(imap.NewUntaggedResp([]interface{}{
+			imap.RawString("VANISHED"), []interface{}{imap.RawString("EARLIER")}, imap.RawString(h.f.vanished),
+		}))
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, c := range h.f.changes {
+		if c.modSeq <= h.changedSince {
+			continue
+		}
+
+		flags := make([]interface{}, len(c.flags))
+		for j, flag := range c.flags {
+			flags[j] = imap.RawString(flag)
+		}
+		err := conn.WriteResp(imap.NewUntaggedResp([]interface{}{
+			uint32(i + 1), imap.RawString("FETCH"), []interface{}{
+				imap.RawString("UID"), c.uid,
+				imap.RawString("FLAGS"), flags,
+				imap.RawString("MODSEQ"), []interface{}{imap.RawString(strconv.FormatUint(c.modSeq, 10))},
+			},
+		}))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listenTestServer runs a go-imap memory server with the given extensions and returns its address
+func listenTestServer(t *testing.T, extensions ...server.Extension) string {
+	t.Helper()
+
+	s := server.New(memory.New())
+	s.AllowInsecureAuth = true
+	s.Enable(extensions...)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ln)
+	t.Cleanup(func() { s.Close() })
+
+	return ln.Addr().String()
+}
+
+// startTestServer runs a go-imap memory server with the given extensions and logs a client into it
+func startTestServer(t *testing.T, extensions ...server.Extension) *client.Client {
+	t.Helper()
+
+	conn, err := client.Dial(listenTestServer(t, extensions...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Logout() })
+
+	if err := conn.Login("username", "password"); err != nil {
+		t.Fatal(err)
+	}
+	enableModSeq(conn)
+	t.Cleanup(func() { modSeqModes.Delete(conn) })
+
+	return conn
+}
+
+// useTestDB points the db package at a fresh SQLite file
+func useTestDB(t *testing.T) {
+	t.Helper()
+
+	conn, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.AutoMigrate(&models.Email{}, &models.MailboxState{}); err != nil {
+		t.Fatal(err)
+	}
+
+	old := db.DB
+	db.DB = conn
+	t.Cleanup(func() { db.DB = old })
+}
+
+// cacheInbox stores cached INBOX messages and a sync state as left by an earlier sync
+func cacheInbox(t *testing.T, modSeq uint64, emails ...models.Email) {
+	t.Helper()
+
+	for i := range emails {
+		emails[i].UIDValidity = testUIDValidity
+		emails[i].Date = time.Now()
+	}
+	if err := db.SaveEmails(1, "INBOX", emails); err != nil {
+		t.Fatal(err)
+	}
+
+	state := &models.MailboxState{
+		AccountID:     1,
+		Mailbox:       "INBOX",
+		UIDValidity:   testUIDValidity,
+		UIDNext:       testUIDNext,
+		HighestModSeq: modSeq,
+	}
+	if err := db.SaveMailboxState(state); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func cachedInbox(t *testing.T) map[uint32]models.Email {
+	t.Helper()
+
+	emails, err := db.GetEmailFlags(1, "INBOX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byUID := make(map[uint32]models.Email, len(emails))
+	for _, e := range emails {
+		byUID[e.UID] = e
+	}
+	return byUID
+}
+
+func TestSyncChangedSinceModSeq(t *testing.T) {
+	useTestDB(t)
+	fake := &fakeModSeq{
+		highest: 12,
+		changes: []modSeqChange{
+			{uid: 4, flags: []string{imap.FlaggedFlag}, modSeq: 8}, // before the stored modseq, must be ignored
+			{uid: testUID, flags: []string{imap.SeenFlag, imap.FlaggedFlag}, modSeq: 11},
+		},
+	}
+	conn := startTestServer(t, fake)
+	if mode := getModSeqMode(conn); mode != modSeqCondstore {
+		t.Fatalf("mode = %d, want CONDSTORE", mode)
+	}
+
+	cacheInbox(t, 10,
+		models.Email{UID: 4},
+		models.Email{UID: testUID, Read: true},
+	)
+
+	result, err := SyncMailbox(conn, 1, "INBOX")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fake.changedSince) != 1 || fake.changedSince[0] != 10 {
+		t.Fatalf("CHANGEDSINCE sent = %v, want [10]", fake.changedSince)
+	}
+	// UID 4 would count as well had its change from modseq 8 been applied
+	if result.Changed != 1 {
+		t.Errorf("Changed = %d, want 1", result.Changed)
+	}
+
+	cached := cachedInbox(t)
+	if !cached[testUID].Starred {
+		t.Errorf("UID %d not starred after sync", testUID)
+	}
+
+	// plain CONDSTORE finds expunges with UID SEARCH, UID 4 isn't on the server
+	if len(result.Deleted) != 1 || result.Deleted[0] != 4 {
+		t.Errorf("Deleted = %v, want [4]", result.Deleted)
+	}
+
+	state, err := db.GetMailboxState(1, "INBOX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.HighestModSeq != 12 {
+		t.Errorf("stored HIGHESTMODSEQ = %d, want 12", state.HighestModSeq)
+	}
+}
+
+func TestSyncVanishedEarlier(t *testing.T) {
+	useTestDB(t)
+	fake := &fakeModSeq{qresync: true, highest: 20, vanished: "2:3,5"}
+	conn := startTestServer(t, fake)
+	if mode := getModSeqMode(conn); mode != modSeqQresync {
+		t.Fatalf("mode = %d, want QRESYNC", mode)
+	}
+
+	cacheInbox(t, 15,
+		models.Email{UID: 2},
+		models.Email{UID: 3},
+		models.Email{UID: 5},
+		models.Email{UID: testUID, Read: true},
+	)
+
+	result, err := SyncMailbox(conn, 1, "INBOX")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Deleted) != 3 {
+		t.Errorf("Deleted = %v, want UIDs 2, 3 and 5", result.Deleted)
+	}
+
+	cached := cachedInbox(t)
+	if len(cached) != 1 {
+		t.Errorf("cache has %d messages, want only UID %d", len(cached), testUID)
+	}
+	if _, ok := cached[testUID]; !ok {
+		t.Errorf("UID %d was dropped but didn't vanish", testUID)
+	}
+}
+
+func TestSyncWithoutCondstore(t *testing.T) {
+	useTestDB(t)
+	conn := startTestServer(t)
+	if mode := getModSeqMode(conn); mode != modSeqNone {
+		t.Fatalf("mode = %d, want none", mode)
+	}
+
+	// a stored modseq from before the server lost CONDSTORE must not matter
+	cacheInbox(t, 10,
+		models.Email{UID: 5},
+		models.Email{UID: testUID},
+	)
+
+	result, err := SyncMailbox(conn, 1, "INBOX")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// syncKnown refetched the flags of every cached message
+	if result.Changed != 1 {
+		t.Errorf("Changed = %d, want 1", result.Changed)
+	}
+	if len(result.Deleted) != 1 || result.Deleted[0] != 5 {
+		t.Errorf("Deleted = %v, want [5]", result.Deleted)
+	}
+
+	cached := cachedInbox(t)
+	if !cached[testUID].Read {
+		t.Errorf("UID %d not read after sync, server has it \\Seen", testUID)
+	}
+
+	state, err := db.GetMailboxState(1, "INBOX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.HighestModSeq != 0 {
+		t.Errorf("stored HIGHESTMODSEQ = %d, want 0", state.HighestModSeq)
+	}
+}
@@ -0,0 +1,92 @@
+package imap
+
+import (
+	"fmt"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// DeleteMessage moves a message to the account's Trash.
+// when there is no Trash, or the message already is in it, it gets \Deleted and is expunged for good
+func DeleteMessage(conn *client.Client, mailbox string, uid uint32) error {
+	trash, err := FindSpecialMailbox(conn, imap.TrashAttr)
+	if err != nil {
+		return err
+	}
+
+	if trash != "" && trash != mailbox {
+		return MoveMessages(conn, mailbox, []uint32{uid}, trash)
+	}
+
+	return removeUIDs(conn, mailbox, []uint32{uid})
+}
+
+// uidExpunge is UID EXPUNGE from UIDPLUS (RFC 4315), only removes the given UIDs
+type uidExpunge struct {
+	seqset *imap.SeqSet
+}
+
+func (cmd *uidExpunge) Command() *imap.Command {
+	return &imap.Command{
+		Name:      "UID",
+		Arguments: []interface{}{imap.RawString("EXPUNGE"), cmd.seqset},
+	}
+}
+
+// expungeUIDs expunges only seqset (UIDs of the selected mailbox) when the server has UIDPLUS.
+// otherwise a plain EXPUNGE is the only option, it would also remove anything else flagged \Deleted
+// (e.g. by another client that hasn't expunged yet), so those lose the flag until it's done
+func expungeUIDs(conn *client.Client, seqset *imap.SeqSet) error {
+	if ok, _ := conn.Support("UIDPLUS"); ok {
+		status, err := conn.Execute(&uidExpunge{seqset: seqset}, nil)
+		if err == nil {
+			err = status.Err()
+		}
+		if err != nil {
+			return fmt.Errorf("failed to expunge: %v", err)
+		}
+		return nil
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.WithFlags = []string{imap.DeletedFlag}
+	deleted, err := conn.UidSearch(criteria)
+	if err != nil {
+		return fmt.Errorf("failed to look for deleted messages: %v", err)
+	}
+
+	others := new(imap.SeqSet)
+	for _, uid := range deleted {
+		if !seqset.Contains(uid) {
+			others.AddNum(uid)
+		}
+	}
+	if !others.Empty() {
+		if err := storeDeleted(conn, others, imap.RemoveFlags); err != nil {
+			return err
+		}
+	}
+
+	err = conn.Expunge(nil)
+
+	// put the flag back even when the EXPUNGE failed
+	if !others.Empty() {
+		if restoreErr := storeDeleted(conn, others, imap.AddFlags); restoreErr != nil && err == nil {
+			err = restoreErr
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to expunge: %v", err)
+	}
+	return nil
+}
+
+// storeDeleted adds or removes \Deleted on UIDs of the selected mailbox
+func storeDeleted(conn *client.Client, seqset *imap.SeqSet, op imap.FlagsOp) error {
+	item := imap.FormatFlagsOp(op, true)
+	if err := conn.UidStore(seqset, item, []interface{}{imap.DeletedFlag}, nil); err != nil {
+		return fmt.Errorf("failed to update \\Deleted on %v: %v", seqset, err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package imap
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// inboxFlags returns the flags of every message in INBOX by UID
+func inboxFlags(t *testing.T, conn *client.Client) map[uint32][]string {
+	t.Helper()
+
+	if err := ensureSelected(conn, "INBOX"); err != nil {
+		t.Fatal(err)
+	}
+	seqset, _ := imap.ParseSeqSet("1:*")
+	messages := make(chan *imap.Message, 10)
+	if err := conn.UidFetch(seqset, []imap.FetchItem{imap.FetchUid, imap.FetchFlags}, messages); err != nil {
+		t.Fatal(err)
+	}
+
+	flags := make(map[uint32][]string)
+	for msg := range messages {
+		flags[msg.Uid] = msg.Flags
+	}
+	return flags
+}
+
+func TestRemoveUIDsKeepsOtherDeletedMail(t *testing.T) {
+	conn := startTestServer(t)
+	if ok, _ := conn.Support("UIDPLUS"); ok {
+		t.Skip("the test server has UIDPLUS, the plain EXPUNGE path isn't used")
+	}
+
+	// UIDs 7 and 8 next to the backend's UID 6
+	for i := 0; i < 2; i++ {
+		msg := []byte("From: a@example.org\r\nSubject: test\r\n\r\nhello\r\n")
+		if err := conn.Append("INBOX", nil, time.Now(), bytes.NewBuffer(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// another client flagged 7 and hasn't expunged yet
+	if err := ensureSelected(conn, "INBOX"); err != nil {
+		t.Fatal(err)
+	}
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(7)
+	if err := storeDeleted(conn, seqset, imap.AddFlags); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := removeUIDs(conn, "INBOX", []uint32{8}); err != nil {
+		t.Fatal(err)
+	}
+
+	flags := inboxFlags(t, conn)
+	if _, ok := flags[8]; ok {
+		t.Error("UID 8 wasn't expunged")
+	}
+	if f, ok := flags[7]; !ok || !hasFlag(f, imap.DeletedFlag) {
+		t.Errorf("UID 7 should still be there flagged \\Deleted, flags %v (there: %v)", f, ok)
+	}
+	if _, ok := flags[6]; !ok {
+		t.Error("UID 6 was expunged")
+	}
+}
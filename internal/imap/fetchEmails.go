@@ -28,22 +28,49 @@ func FetchEmails(conn *client.Client, mailbox string, pageSize int, pageNumber i
 	seqset := new(imap.SeqSet)
 	seqset.AddRange(uint32(from), uint32(to))
 
+	emails, err := fetchMessages(conn, seqset, false, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range emails {
+		emails[i].Mailbox = mailbox
+		emails[i].UIDValidity = mbox.UidValidity
+	}
+
+	return emails, nil
+}
+
+// fetchMessages fetches and parses full messages of the selected mailbox, newest first.
+// uid tells whether seqset holds UIDs or sequence numbers
+func fetchMessages(conn *client.Client, seqset *imap.SeqSet, uid bool, size int) ([]models.Email, error) {
 	// Request:
+	// - UID (cache key, stable unlike sequence numbers)
+	// - Flags (read/starred/answered/draft/deleted)
 	// - Envelope (meta)
 	// - BodyStructure (parts)
-	// - BODY[] full RFC822 message
-	section := &imap.BodySectionName{}
+	// - BODY.PEEK[] full RFC822 message, peek so fetching doesn't set \Seen on the server
+	section := &imap.BodySectionName{Peek: true}
 	items := []imap.FetchItem{
+		imap.FetchUid,
+		imap.FetchFlags,
 		imap.FetchEnvelope,
 		imap.FetchBodyStructure,
 		section.FetchItem(),
 	}
 
-	messages := make(chan *imap.Message, pageSize)
+	if size <= 0 {
+		size = 10
+	}
+	messages := make(chan *imap.Message, size)
 	done := make(chan error, 1)
 
 	go func() {
-		done <- conn.Fetch(seqset, items, messages)
+		if uid {
+			done <- conn.UidFetch(seqset, items, messages)
+		} else {
+			done <- conn.Fetch(seqset, items, messages)
+		}
 	}()
 
 	var emails []models.Email
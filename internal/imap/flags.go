@@ -0,0 +1,24 @@
+package imap
+
+import (
+	"github.com/emersion/go-imap"
+	"github.com/vky5/mailcat/internal/db/models"
+)
+
+// applyFlags maps the IMAP system flags of a message onto the Email fields
+func applyFlags(e *models.Email, flags []string) {
+	e.Read = hasFlag(flags, imap.SeenFlag)
+	e.Starred = hasFlag(flags, imap.FlaggedFlag)
+	e.Answered = hasFlag(flags, imap.AnsweredFlag)
+	e.Draft = hasFlag(flags, imap.DraftFlag)
+	e.Deleted = hasFlag(flags, imap.DeletedFlag)
+}
+
+func hasFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if imap.CanonicalFlag(f) == flag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package imap
+
+import (
+	"fmt"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// CreateMailbox creates a folder, parents included on most servers
+func CreateMailbox(conn *client.Client, name string) error {
+	if err := conn.Create(name); err != nil {
+		return fmt.Errorf("failed to create %s: %w", name, err)
+	}
+	return nil
+}
+
+// RenameMailbox renames a folder, its subfolders move along with it
+func RenameMailbox(conn *client.Client, from, to string) error {
+	if err := conn.Rename(from, to); err != nil {
+		return fmt.Errorf("failed to rename %s to %s: %w", from, to, err)
+	}
+	return nil
+}
+
+// DeleteMailbox deletes a folder and every message in it
+func DeleteMailbox(conn *client.Client, name string) error {
+	// a connection that has the folder open would be left pointing at nothing
+	if cur := conn.Mailbox(); cur != nil && cur.Name == name {
+		if _, err := conn.Select("INBOX", true); err != nil {
+			return fmt.Errorf("failed to leave %s: %w", name, err)
+		}
+	}
+
+	if err := conn.Delete(name); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", name, err)
+	}
+	return nil
+}
+
+// Subscribe adds a folder to the subscribed ones (LSUB)
+func Subscribe(conn *client.Client, name string) error {
+	if err := conn.Subscribe(name); err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", name, err)
+	}
+	return nil
+}
+
+// Unsubscribe removes a folder from the subscribed ones, the folder itself stays
+func Unsubscribe(conn *client.Client, name string) error {
+	if err := conn.Unsubscribe(name); err != nil {
+		return fmt.Errorf("failed to unsubscribe from %s: %w", name, err)
+	}
+	return nil
+}
+
+// SubscribedMailboxes returns the names LSUB reports
+func SubscribedMailboxes(conn *client.Client) (map[string]bool, error) {
+	subscribed := make(map[string]bool)
+
+	mboxChan := make(chan *imap.MailboxInfo, 20)
+	done := make(chan error, 1)
+
+	go func() {
+		done <- conn.Lsub("", "*", mboxChan)
+	}()
+
+	for m := range mboxChan {
+		subscribed[m.Name] = true
+	}
+
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("error listing subscribed mailboxes: %w", err)
+	}
+
+	return subscribed, nil
+}
+
+// Delimiter returns the hierarchy separator of the account, "" for a flat namespace
+func Delimiter(conn *client.Client) (string, error) {
+	mboxChan := make(chan *imap.MailboxInfo, 1)
+	done := make(chan error, 1)
+
+	// LIST "" "" asks for the delimiter only
+	go func() {
+		done <- conn.List("", "", mboxChan)
+	}()
+
+	delimiter := ""
+	for m := range mboxChan {
+		delimiter = m.Delimiter
+	}
+
+	if err := <-done; err != nil {
+		return "", fmt.Errorf("failed to get hierarchy delimiter: %w", err)
+	}
+	return delimiter, nil
+}
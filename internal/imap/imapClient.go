@@ -3,10 +3,14 @@ package imap
 import (
 	"crypto/tls"
 	"fmt"
-	"log"
+	"strconv"
 
 	"github.com/emersion/go-imap/client"
+	"github.com/vky5/mailcat/internal/credentials"
 	"github.com/vky5/mailcat/internal/db/models"
+	"github.com/vky5/mailcat/internal/logger"
+	"github.com/vky5/mailcat/internal/oauth"
+	"github.com/vky5/mailcat/internal/tlsutil"
 )
 
 // connect to the IMAP server
@@ -16,37 +20,122 @@ func ConnectIMAP(acc models.Account) (*client.Client, error) {
 	var err error
 
 	address := fmt.Sprintf("%s:%s", acc.Host, acc.Port)
+	// CA bundle, pin, client certificate... are per account
+	tlsConfig, err := tlsutil.Config(acc, acc.Host)
+	if err != nil {
+		return nil, err
+	}
 
-	// connect to the server and secure determines over tls or not
-	// connect using TLS
-	if acc.Secure {
-		conn, err = client.DialTLS(address, &tls.Config{
-			ServerName: acc.Host, // needed for TLS verification
-		})
-	} else {
+	// connect to the server, the security mode decides about TLS
+	switch acc.Security {
+	case models.SecurityNone, models.SecuritySTARTTLS, models.SecuritySTARTTLSOptional:
 		conn, err = client.Dial(address)
+	default:
+		// implicit TLS, also what an account without a mode gets
+		conn, err = client.DialTLS(address, tlsConfig)
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect: %v", err)
+		return nil, fmt.Errorf("failed to connect: %w", tlsutil.Explain(acc.Host, err))
+	}
+
+	if acc.Security == models.SecuritySTARTTLS || acc.Security == models.SecuritySTARTTLSOptional {
+		if err := startTLS(conn, acc, tlsConfig); err != nil {
+			conn.Logout()
+			return nil, err
+		}
+	}
+
+	// never hand the password to an eavesdropper unless the user asked for it
+	if !conn.IsTLS() && !acc.AllowPlaintextAuth {
+		conn.Logout()
+		return nil, fmt.Errorf("refusing to log in to %s over an unencrypted connection (allow it with !plaintext)", acc.Host)
+	}
+
+	// the password may live outside the DB (pass, env, netrc...)
+	password, err := credentials.Lookup(acc, acc.Host)
+	if err != nil {
+		conn.Logout()
+		return nil, err
 	}
 
 	// once the connection is established with acc.host then login
 	// Login
-	if err := conn.Login(acc.Email, acc.Password); err != nil {
+	if credentials.UsesOAuth(acc) {
+		err = authenticateOAuth(conn, acc, password)
+	} else {
+		err = conn.Login(acc.Email, password)
+	}
+	if err != nil {
 		conn.Logout() // if login fails exit
 		return nil, fmt.Errorf("failed to login: %v", err)
 	}
 
-	log.Println("Connected and logged in to", acc.Host)
+	logger.Info("Connected and logged in to", acc.Host)
+
+	// CONDSTORE/QRESYNC have to be enabled before the first SELECT
+	enableModSeq(conn)
 
 	return conn, err
 }
 
+// startTLS upgrades the connection. a server without STARTTLS is an error,
+// unless the mode is starttls-optional, then the connection simply stays plain text
+func startTLS(conn *client.Client, acc models.Account, tlsConfig *tls.Config) error {
+	ok, err := conn.SupportStartTLS()
+	if err != nil {
+		return fmt.Errorf("failed to read capabilities of %s: %v", acc.Host, err)
+	}
+
+	if !ok {
+		if acc.Security == models.SecuritySTARTTLSOptional {
+			logger.Warn("No STARTTLS on", acc.Host, "- staying unencrypted")
+			return nil
+		}
+		return fmt.Errorf("%s does not support STARTTLS", acc.Host)
+	}
+
+	if err := conn.StartTLS(tlsConfig); err != nil {
+		return fmt.Errorf("STARTTLS with %s failed: %w", acc.Host, tlsutil.Explain(acc.Host, err))
+	}
+	return nil
+}
+
+// authenticateOAuth logs in with OAUTHBEARER or XOAUTH2 using an access token
+func authenticateOAuth(conn *client.Client, acc models.Account, token string) error {
+	supports := func(mech string) bool {
+		ok, _ := conn.SupportAuth(mech)
+		return ok
+	}
+
+	port, _ := strconv.Atoi(acc.Port)
+	auth, err := oauth.NewClient(supports, acc.Email, token, acc.Host, port)
+	if err != nil {
+		return err
+	}
+
+	if err := conn.Authenticate(auth); err != nil {
+		// the cached token may have been revoked, the next attempt gets a fresh one
+		oauth.Invalidate(acc.ID)
+		return err
+	}
+	return nil
+}
+
+// DefaultPort is the usual IMAP port of a security mode
+func DefaultPort(security string) string {
+	if security == "" || security == models.SecurityTLS {
+		return "993"
+	}
+	return "143"
+}
+
 func Logout(conn *client.Client) {
+	modSeqModes.Delete(conn)
+
 	if err := conn.Logout(); err != nil {
-		log.Println("Error logging out:", err)
+		logger.Error("Error logging out:", err)
 	} else {
-		log.Println("Logged out Successfully")
+		logger.Info("Logged out Successfully")
 	}
 }
@@ -2,13 +2,53 @@ package imap
 
 import (
 	"fmt"
+	"strings"
+
 	"github.com/emersion/go-imap"
 	"github.com/emersion/go-imap/client"
 )
 
+// the SPECIAL-USE attributes (RFC 6154) we give a meaning to, plus Gmail's \Important
+var specialUses = []string{
+	imap.SentAttr, imap.DraftsAttr, imap.TrashAttr, imap.JunkAttr,
+	imap.ArchiveAttr, imap.AllAttr, imap.FlaggedAttr, imap.ImportantAttr,
+}
+
+// Mailbox is one LIST entry
+type Mailbox struct {
+	Name       string
+	Delimiter  string // hierarchy separator, e.g "/" or ".", empty for a flat namespace
+	Attributes []string
+}
+
+// Has reports whether the server gave the mailbox attr
+func (m Mailbox) Has(attr string) bool {
+	for _, a := range m.Attributes {
+		if strings.EqualFold(a, attr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Selectable is false for containers that only hold other mailboxes
+func (m Mailbox) Selectable() bool {
+	return !m.Has(imap.NoSelectAttr) && !m.Has("\\NonExistent")
+}
+
+// SpecialUse returns the SPECIAL-USE attribute of the mailbox such as \Sent, "" if it has none
+func (m Mailbox) SpecialUse() string {
+	for _, attr := range specialUses {
+		if m.Has(attr) {
+			return attr
+		}
+	}
+	return ""
+}
 
-func ListMailboxes(conn *client.Client) ([]string, error) {
-	mailboxes := []string{}
+// ListMailboxes returns every mailbox of the account with its attributes and delimiter
+func ListMailboxes(conn *client.Client) ([]Mailbox, error) {
+	mailboxes := []Mailbox{}
 
 	// "" = root, "*" = wildcard (all mailboxes)
 	mboxChan := make(chan *imap.MailboxInfo, 20)
@@ -19,7 +59,11 @@ func ListMailboxes(conn *client.Client) ([]string, error) {
 	}()
 
 	for m := range mboxChan {
-		mailboxes = append(mailboxes, m.Name)
+		mailboxes = append(mailboxes, Mailbox{
+			Name:       m.Name,
+			Delimiter:  m.Delimiter,
+			Attributes: m.Attributes,
+		})
 	}
 
 	if err := <-done; err != nil {
@@ -27,4 +71,4 @@ func ListMailboxes(conn *client.Client) ([]string, error) {
 	}
 
 	return mailboxes, nil
-}
\ No newline at end of file
+}
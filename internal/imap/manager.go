@@ -1,46 +1,480 @@
 package imap
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
 	"sync"
+	"time"
 
+	"github.com/emersion/go-imap"
 	"github.com/emersion/go-imap/client"
 	"github.com/vky5/mailcat/internal/db/models"
+	"github.com/vky5/mailcat/internal/logger"
 )
 
+// ConnState is what the pool knows about the connections of an account
+type ConnState int
+
+const (
+	StateNone         ConnState = iota // nothing tried yet
+	StateConnected                     // logged in and answering
+	StateReconnecting                  // lost or unreachable, another try is scheduled
+	StateOffline                       // gave up until something asks for a connection again
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateOffline:
+		return "offline"
+	default:
+		return "not connected"
+	}
+}
+
+const (
+	// worker connections per account, commands beyond that wait for a free one
+	workersPerAccount = 3
+
+	// a connection used this recently is trusted without a NOOP
+	healthInterval = 30 * time.Second
+	noopTimeout    = 10 * time.Second
+
+	reconnectMin         = 2 * time.Second
+	reconnectMax         = 5 * time.Minute
+	maxReconnectAttempts = 8
+)
+
+// slot holds one connection. whoever took the slot out of its channel owns the connection,
+// so a SELECT on one can never interleave with an IDLE or another SELECT
+type slot struct {
+	conn      *client.Client
+	lastCheck time.Time
+	quit      chan struct{} // closed when the connection is dropped on purpose
+}
+
+// idleSlot is the connection reserved for one IDLE key, users counts the DoIdle calls on it right now
+type idleSlot struct {
+	slots chan *slot
+	users int
+}
+
+// accountPool is every connection of one account:
+// a few workers for normal commands and connections reserved for IDLE, one per key (usually a folder)
+type accountPool struct {
+	workers chan *slot
+
+	mu       sync.Mutex // guards idle, acc, failures and retry
+	idle     map[string]*idleSlot
+	acc      models.Account
+	failures int
+	retry    *time.Timer
+
+	// guarded by stateMu so State() never waits on a dial
+	state   ConnState
+	lastErr error
+}
+
 var (
-	connPool = make(map[uint]*client.Client)
-	mu       sync.RWMutex
+	pools   = make(map[uint]*accountPool)
+	mu      sync.RWMutex
+	stateMu sync.Mutex
+	closing bool
+
+	listenersMu sync.Mutex
+	listeners   []func(accountID uint, state ConnState, err error)
 )
 
-func GetConnection(acc models.Account) (*client.Client, error) {
+// OnStateChange registers fn to be told whenever an account's connection state changes.
+// it is called from pool goroutines, UI code has to hop back onto its own thread
+func OnStateChange(fn func(accountID uint, state ConnState, err error)) {
+	listenersMu.Lock()
+	listeners = append(listeners, fn)
+	listenersMu.Unlock()
+}
+
+// State returns the connection state of an account and the last error, if any
+func State(accountID uint) (ConnState, error) {
 	mu.RLock()
-	conn, exists := connPool[acc.ID]
+	p, ok := pools[accountID]
 	mu.RUnlock()
+	if !ok {
+		return StateNone, nil
+	}
 
-	if exists {
-		return conn, nil
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	return p.state, p.lastErr
+}
+
+// Do runs fn on one of the account's worker connections, waiting for one to be free.
+// the connection belongs to fn until it returns and must not be kept after that
+func Do(acc models.Account, fn func(conn *client.Client) error) error {
+	p, err := poolFor(acc)
+	if err != nil {
+		return err
 	}
+	return p.run(p.workers, fn)
+}
 
-	// Make new connection
-	newConn, err := ConnectIMAP(acc)
+// DoIdle runs fn on a dedicated IDLE connection of the account, so a long IDLE never holds up a worker.
+// every key (e.g. the folder being watched) gets its own connection, only one fn at a time per key
+func DoIdle(acc models.Account, key string, fn func(conn *client.Client) error) error {
+	p, err := poolFor(acc)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	p.mu.Lock()
+	is, ok := p.idle[key]
+	if !ok {
+		is = &idleSlot{slots: make(chan *slot, 1)}
+		is.slots <- &slot{}
+		p.idle[key] = is
+	}
+	is.users++
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		is.users--
+		p.mu.Unlock()
+	}()
+
+	return p.run(is.slots, fn)
+}
+
+// ReleaseIdle logs out the IDLE connection of key once nothing watches through it anymore.
+// while a DoIdle call is still running on the key it's left alone, that caller releases it later
+func ReleaseIdle(accountID uint, key string) {
+	mu.RLock()
+	p, ok := pools[accountID]
+	mu.RUnlock()
+	if !ok {
+		return
 	}
 
-	// Store it
+	p.mu.Lock()
+	is, ok := p.idle[key]
+	if !ok || is.users > 0 {
+		p.mu.Unlock()
+		return
+	}
+	delete(p.idle, key)
+	p.mu.Unlock()
+
+	// out of the map and unused, so the slot is in the channel and nobody else can take it
+	(<-is.slots).logout()
+}
+
+func poolFor(acc models.Account) (*accountPool, error) {
 	mu.Lock()
-	connPool[acc.ID] = newConn
-	mu.Unlock()
+	defer mu.Unlock()
+
+	if closing {
+		return nil, fmt.Errorf("connection pool is closed")
+	}
+
+	p, ok := pools[acc.ID]
+	if !ok {
+		p = &accountPool{
+			workers: make(chan *slot, workersPerAccount),
+			idle:    make(map[string]*idleSlot),
+		}
+		for i := 0; i < workersPerAccount; i++ {
+			p.workers <- &slot{}
+		}
+		pools[acc.ID] = p
+	}
+
+	// settings may have changed since the last dial
+	p.mu.Lock()
+	p.acc = acc
+	p.mu.Unlock()
+
+	return p, nil
+}
+
+// run takes a slot from slots (queueing behind other callers), makes sure its connection works and hands it to fn
+func (p *accountPool) run(slots chan *slot, fn func(conn *client.Client) error) error {
+	s := <-slots
+	defer func() { slots <- s }()
+
+	conn, err := p.ready(s)
+	if err != nil {
+		return err
+	}
+
+	err = fn(conn)
 
-	return newConn, nil
+	// a broken connection is only noticed here, don't hand it to the next caller
+	if err != nil && retryable(err) {
+		logger.Warn("IMAP connection to", p.account().Host, "broke:", err)
+		p.drop(s)
+	}
+	return err
 }
 
+// ready returns the slot's connection, dialing a new one when it's missing or dead
+func (p *accountPool) ready(s *slot) (*client.Client, error) {
+	mu.RLock()
+	stop := closing
+	mu.RUnlock()
+	if stop {
+		return nil, fmt.Errorf("connection pool is closed")
+	}
+
+	if s.conn != nil {
+		if p.healthy(s) {
+			return s.conn, nil
+		}
+		logger.Warn("IMAP connection to", p.account().Host, "is dead, reconnecting")
+		p.drop(s)
+	}
+
+	return p.dial(s)
+}
+
+// healthy reports whether the slot's connection still works: not logged out, and answering NOOP
+// when it hasn't been used for a while
+func (p *accountPool) healthy(s *slot) bool {
+	select {
+	case <-s.conn.LoggedOut():
+		return false
+	default:
+	}
+
+	if s.conn.State() == imap.LogoutState {
+		return false
+	}
+
+	if time.Since(s.lastCheck) < healthInterval {
+		return true
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- s.conn.Noop() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			logger.Warn("NOOP failed on", p.account().Host, ":", err)
+			return false
+		}
+	case <-time.After(noopTimeout):
+		logger.Warn("NOOP timed out on", p.account().Host)
+		return false
+	}
+
+	s.lastCheck = time.Now()
+	return true
+}
+
+// drop closes the slot's connection, a dead connection won't answer LOGOUT so the socket is just closed
+func (p *accountPool) drop(s *slot) {
+	close(s.quit)
+	modSeqModes.Delete(s.conn)
+	s.conn.Terminate()
+	s.conn = nil
+}
+
+// dial connects the slot and updates the state, network failures schedule a retry
+func (p *accountPool) dial(s *slot) (*client.Client, error) {
+	stateMu.Lock()
+	offline := p.state == StateOffline
+	stateMu.Unlock()
+
+	p.mu.Lock()
+	acc := p.acc
+	// asking again after giving up starts a fresh round of retries
+	if offline {
+		p.failures = 0
+	}
+	p.mu.Unlock()
+
+	conn, err := ConnectIMAP(acc)
+	if err != nil {
+		p.failed(err)
+		return nil, err
+	}
+
+	s.conn = conn
+	s.lastCheck = time.Now()
+	s.quit = make(chan struct{})
+
+	p.mu.Lock()
+	p.failures = 0
+	if p.retry != nil {
+		p.retry.Stop()
+		p.retry = nil
+	}
+	p.mu.Unlock()
+	p.setState(StateConnected, nil)
+
+	go p.watch(conn, s.quit)
+	return conn, nil
+}
+
+// failed records a failed dial or lost connection and schedules the next try
+func (p *accountPool) failed(err error) {
+	p.mu.Lock()
+	p.failures++
+	failures := p.failures
+	host := p.acc.Host
+
+	// wrong password, bad certificate... won't get better by retrying
+	if !retryable(err) || failures >= maxReconnectAttempts {
+		p.mu.Unlock()
+		p.setState(StateOffline, err)
+		return
+	}
+
+	if p.retry == nil {
+		delay := reconnectDelay(failures)
+		logger.Warn("IMAP connection to", host, "failed, retrying in", delay, ":", err)
+		p.retry = time.AfterFunc(delay, p.reconnect)
+	}
+	p.mu.Unlock()
+	p.setState(StateReconnecting, err)
+}
+
+// reconnect is the scheduled retry, it brings a free worker back up.
+// when all workers are busy they are being used, and will report the state themselves
+func (p *accountPool) reconnect() {
+	p.mu.Lock()
+	p.retry = nil
+	p.mu.Unlock()
+
+	select {
+	case s := <-p.workers:
+		p.ready(s)
+		p.workers <- s
+	default:
+	}
+}
+
+// watch notices the server closing a connection, so the state is right before anyone asks for it again
+func (p *accountPool) watch(conn *client.Client, quit chan struct{}) {
+	select {
+	case <-quit:
+		return
+	case <-conn.LoggedOut():
+	}
+
+	mu.RLock()
+	stop := closing
+	mu.RUnlock()
+
+	// both may be ready at once when the connection was dropped on purpose
+	select {
+	case <-quit:
+		return
+	default:
+	}
+	if stop {
+		return
+	}
+
+	logger.Warn("IMAP server", p.account().Host, "closed the connection")
+	p.failed(fmt.Errorf("connection closed by server: %w", io.EOF))
+}
+
+func (p *accountPool) account() models.Account {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.acc
+}
+
+func (p *accountPool) setState(state ConnState, err error) {
+	stateMu.Lock()
+	changed := p.state != state
+	p.state = state
+	p.lastErr = err
+	stateMu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	listenersMu.Lock()
+	fns := append([]func(uint, ConnState, error){}, listeners...)
+	listenersMu.Unlock()
+
+	id := p.account().ID
+	for _, fn := range fns {
+		fn(id, state, err)
+	}
+}
+
+// retryable is true for errors from the network, as opposed to the server or config refusing us
+func retryable(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// reconnectDelay doubles per failure with ±25% jitter, so accounts on the same server don't retry in lockstep
+func reconnectDelay(failures int) time.Duration {
+	delay := reconnectMin
+	for i := 1; i < failures && delay < reconnectMax; i++ {
+		delay *= 2
+	}
+	if delay > reconnectMax {
+		delay = reconnectMax
+	}
+
+	jitter := time.Duration(rand.Int63n(int64(delay)/2)) - delay/4
+	return delay + jitter
+}
+
+// CloseAll logs out every connection not in use, the busy ones die with the process
 func CloseAll() {
 	mu.Lock()
-	defer mu.Unlock()
+	closing = true
+	accounts := pools
+	pools = make(map[uint]*accountPool)
+	mu.Unlock()
+
+	for _, p := range accounts {
+		p.close()
+	}
+}
+
+// close logs out the pool's connections not in use and stops reconnecting
+func (p *accountPool) close() {
+	p.mu.Lock()
+	if p.retry != nil {
+		p.retry.Stop()
+	}
+	all := []chan *slot{p.workers}
+	for _, is := range p.idle {
+		all = append(all, is.slots)
+	}
+	p.mu.Unlock()
+
+	for _, slots := range all {
+		for i := 0; i < cap(slots); i++ {
+			select {
+			case s := <-slots:
+				s.logout()
+			default:
+			}
+		}
+	}
+}
 
-	for id, conn := range connPool {
-		conn.Logout()
-		delete(connPool, id)
+// logout ends the slot's connection politely, unlike drop it expects the server to answer
+func (s *slot) logout() {
+	if s.conn == nil {
+		return
 	}
+	close(s.quit)
+	modSeqModes.Delete(s.conn)
+	s.conn.Logout()
+	s.conn = nil
 }
@@ -0,0 +1,111 @@
+package imap
+
+import (
+	"net"
+	"testing"
+
+	"github.com/emersion/go-imap/client"
+	"github.com/vky5/mailcat/internal/db/models"
+)
+
+// testAccount is an account on a fresh memory server, its pool is dropped when the test ends
+func testAccount(t *testing.T, id uint) models.Account {
+	t.Helper()
+
+	host, port, _ := net.SplitHostPort(listenTestServer(t))
+	t.Cleanup(func() {
+		mu.Lock()
+		p := pools[id]
+		delete(pools, id)
+		mu.Unlock()
+		if p != nil {
+			p.close()
+		}
+	})
+
+	return models.Account{
+		ID:                 id,
+		Email:              "username",
+		Password:           "password",
+		Host:               host,
+		Port:               port,
+		Security:           models.SecurityNone,
+		AllowPlaintextAuth: true,
+	}
+}
+
+func idleKeys(accountID uint) map[string]bool {
+	mu.RLock()
+	p := pools[accountID]
+	mu.RUnlock()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	keys := make(map[string]bool)
+	for key := range p.idle {
+		keys[key] = true
+	}
+	return keys
+}
+
+func TestReleaseIdle(t *testing.T) {
+	acc := testAccount(t, 9001)
+
+	var inbox, other *client.Client
+	for key, conn := range map[string]**client.Client{"INBOX": &inbox, "Archive": &other} {
+		err := DoIdle(acc, key, func(c *client.Client) error {
+			*conn = c
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ReleaseIdle(acc.ID, "INBOX")
+
+	select {
+	case <-inbox.LoggedOut():
+	default:
+		t.Error("released IDLE connection is still logged in")
+	}
+	if keys := idleKeys(acc.ID); keys["INBOX"] || !keys["Archive"] {
+		t.Errorf("IDLE keys after release = %v, want only Archive", keys)
+	}
+	select {
+	case <-other.LoggedOut():
+		t.Error("the other IDLE connection was logged out too")
+	default:
+	}
+
+	// asking again dials a fresh one
+	err := DoIdle(acc, "INBOX", func(c *client.Client) error {
+		if c == inbox {
+			t.Error("got the released connection back")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReleaseIdleWhileInUse(t *testing.T) {
+	acc := testAccount(t, 9002)
+
+	err := DoIdle(acc, "INBOX", func(c *client.Client) error {
+		// a new watcher took the key over before the old one let go
+		ReleaseIdle(acc.ID, "INBOX")
+		if !idleKeys(acc.ID)["INBOX"] {
+			t.Error("a connection in use was released")
+		}
+		return c.Noop()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// unknown keys and accounts are ignored
+	ReleaseIdle(acc.ID, "nope")
+	ReleaseIdle(12345, "INBOX")
+}
@@ -0,0 +1,197 @@
+package imap
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/vky5/mailcat/internal/db"
+	"github.com/vky5/mailcat/internal/db/models"
+)
+
+// MoveMessages moves messages to another folder of the same account.
+// UID MOVE (RFC 6851) when the server has it, COPY + \Deleted + EXPUNGE otherwise
+func MoveMessages(conn *client.Client, from string, uids []uint32, to string) error {
+	if len(uids) == 0 {
+		return nil
+	}
+
+	if err := ensureSelected(conn, from); err != nil {
+		return err
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uids...)
+
+	if ok, _ := conn.Support("MOVE"); ok {
+		if err := conn.UidMove(seqset, to); err != nil {
+			return fmt.Errorf("failed to move %v from %s to %s: %w", uids, from, to, err)
+		}
+		return nil
+	}
+
+	// go-imap has its own fallback, but it ends in a plain EXPUNGE that takes other \Deleted mail along.
+	// removeUIDs keeps those, with UID EXPUNGE or by unflagging them around the EXPUNGE
+	if err := conn.UidCopy(seqset, to); err != nil {
+		return fmt.Errorf("failed to copy %v from %s to %s: %w", uids, from, to, err)
+	}
+	return removeUIDs(conn, from, uids)
+}
+
+// CopyMessages copies messages to another folder of the same account
+func CopyMessages(conn *client.Client, from string, uids []uint32, to string) error {
+	if len(uids) == 0 {
+		return nil
+	}
+
+	if err := ensureSelected(conn, from); err != nil {
+		return err
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uids...)
+
+	if err := conn.UidCopy(seqset, to); err != nil {
+		return fmt.Errorf("failed to copy %v from %s to %s: %w", uids, from, to, err)
+	}
+	return nil
+}
+
+// RawMessage is a whole message as stored on the server, enough to APPEND it somewhere else
+type RawMessage struct {
+	UID   uint32
+	Flags []string
+	Date  time.Time // INTERNALDATE
+	Body  []byte
+}
+
+// FetchRaw downloads whole messages with their flags and internal date, without marking them \Seen
+func FetchRaw(conn *client.Client, mailbox string, uids []uint32) ([]RawMessage, error) {
+	if len(uids) == 0 {
+		return nil, nil
+	}
+
+	if err := ensureSelected(conn, mailbox); err != nil {
+		return nil, err
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uids...)
+
+	section := &imap.BodySectionName{Peek: true}
+	items := []imap.FetchItem{imap.FetchUid, imap.FetchFlags, imap.FetchInternalDate, section.FetchItem()}
+
+	messages := make(chan *imap.Message, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- conn.UidFetch(seqset, items, messages)
+	}()
+
+	var raws []RawMessage
+	var readErr error
+	for msg := range messages {
+		body := msg.GetBody(section)
+		if body == nil {
+			continue
+		}
+		data, err := io.ReadAll(body)
+		if err != nil && readErr == nil {
+			readErr = err
+		}
+		raws = append(raws, RawMessage{UID: msg.Uid, Flags: msg.Flags, Date: msg.InternalDate, Body: data})
+	}
+
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("failed to fetch %v from %s: %w", uids, mailbox, err)
+	}
+	if readErr != nil {
+		return nil, fmt.Errorf("failed to read message from %s: %w", mailbox, readErr)
+	}
+	return raws, nil
+}
+
+// AppendRaw stores a message fetched with FetchRaw, keeping its flags and date
+func AppendRaw(conn *client.Client, mailbox string, msg RawMessage) error {
+	// \Recent belongs to the server, APPEND can't set it
+	var flags []string
+	for _, f := range msg.Flags {
+		if !strings.EqualFold(f, imap.RecentFlag) {
+			flags = append(flags, f)
+		}
+	}
+
+	if err := conn.Append(mailbox, flags, msg.Date, bytes.NewBuffer(msg.Body)); err != nil {
+		return fmt.Errorf("failed to append to %s: %w", mailbox, err)
+	}
+	return nil
+}
+
+// Transfer moves or copies messages to a folder of the same or another account.
+// across accounts the messages are downloaded and APPENDed with their flags, then removed from the source when moving.
+// moved messages are dropped from the local cache, the target folder picks them up on its next sync
+func Transfer(src models.Account, from string, uids []uint32, dst models.Account, to string, move bool) error {
+	if len(uids) == 0 {
+		return nil
+	}
+	if src.ID == dst.ID && from == to {
+		return fmt.Errorf("messages already are in %s", to)
+	}
+
+	var err error
+	if src.ID == dst.ID {
+		err = Do(src, func(conn *client.Client) error {
+			if move {
+				return MoveMessages(conn, from, uids, to)
+			}
+			return CopyMessages(conn, from, uids, to)
+		})
+	} else {
+		err = transferAcross(src, from, uids, dst, to, move)
+	}
+	if err != nil {
+		return err
+	}
+
+	if move {
+		if err := db.DeleteEmailsByUID(src.ID, from, uids); err != nil {
+			return fmt.Errorf("failed to drop moved messages from cache: %w", err)
+		}
+	}
+	return nil
+}
+
+// transferAcross copies messages between two accounts, the source copies are only removed once all of them arrived
+func transferAcross(src models.Account, from string, uids []uint32, dst models.Account, to string, move bool) error {
+	var raws []RawMessage
+	err := Do(src, func(conn *client.Client) error {
+		var err error
+		raws, err = FetchRaw(conn, from, uids)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if len(raws) != len(uids) {
+		return fmt.Errorf("only %d of %d messages found in %s", len(raws), len(uids), from)
+	}
+
+	err = Do(dst, func(conn *client.Client) error {
+		for _, raw := range raws {
+			if err := AppendRaw(conn, to, raw); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil || !move {
+		return err
+	}
+
+	return Do(src, func(conn *client.Client) error {
+		return removeUIDs(conn, from, uids)
+	})
+}
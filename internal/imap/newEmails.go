@@ -2,73 +2,60 @@ package imap
 
 import (
 	"fmt"
-	"log"
-	"time"
 
 	"github.com/emersion/go-imap/client"
-	"github.com/vky5/mailcat/internal/db/models"
+	"github.com/vky5/mailcat/internal/logger"
 )
 
-// constantly listen to new emails on a given IMAP connnection and mailbox
-func ListenNewEmails(conn *client.Client, mailbox string, out chan models.Email) error {
-	mbox, err := conn.Select(mailbox, false)
+// IdleMailbox sits in IDLE on mailbox and calls changed whenever the server reports new, expunged
+// or changed messages, until stop is closed. the connection can't be used for anything else meanwhile,
+// so changed should only note what happened and leave the fetching to another connection
+func IdleMailbox(conn *client.Client, mailbox string, changed func(), stop <-chan struct{}) error {
+	// EXAMINE, just watching shouldn't clear \Recent
+	mbox, err := conn.Select(mailbox, true)
 	if err != nil {
 		return fmt.Errorf("failed to select mailbox %s: %v", mailbox, err)
 	}
-	log.Printf("Listening for new emails in %s (currently %d messages)\n", mailbox, mbox.Messages)
+	logger.Info("Listening for new emails in", mailbox, "currently", mbox.Messages, "messages")
 
-	updates := make(chan client.Update) // type from go-imap that represents any kind of updates the IMAP server sends (new message, message deletion, flag change)
-	conn.Updates = updates              // Updates is a conn's field which tells conn whenever the server sends any update, push it into this channel
+	updates := make(chan client.Update, 16) // type from go-imap that represents any kind of updates the IMAP server sends (new message, message deletion, flag change)
+	conn.Updates = updates                  // Updates is a conn's field which tells conn whenever the server sends any update, push it into this channel
 
-	for {
-		stop := make(chan struct{})
-		done := make(chan error, 1)
-
-		// sit idle and receive push style updates liek new message so instead of polling every few sec the client sends IDLE and server responds with idling
-		// for new event server sends `23 EXISTS` to stop idling the client sends DONE
-		go func() {
-			done <- conn.Idle(stop, nil) // idle is to keeping the loop for lisening to new message open and if there is any new message or something else, it sends that update to updaate channel, the done is our own channel listening to current state of the client (us) like if it exited properly or something happened
+	// the connection goes back to the pool, nobody would drain the channel after us
+	defer func() { conn.Updates = nil }()
 
-			// first argument of Idle (stop) is the control argument to tell goroutine when to stop
-			// the second argument can be the update channel if we wanted it to receive messages but we already have made this conn.Updates channel for delivering message
-		}()
+	// sit idle and receive push style updates like new message so instead of polling every few sec the client sends IDLE and server responds with idling
+	// for new event server sends `23 EXISTS`, go-imap restarts the IDLE on its own before the server's 30 min timeout
+	stopIdle := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- conn.Idle(stopIdle, nil)
+	}()
 
+	for {
 		select {
 		case update := <-updates:
-			// check for new messages
-			if mboxUpdate, ok := update.(*client.MailboxUpdate); ok {
-				if mboxUpdate.Mailbox.Messages > mbox.Messages {
-					newCount := mboxUpdate.Mailbox.Messages - mbox.Messages
-					log.Printf("New %d messages detected\n", newCount)
-				}
+			switch update.(type) {
+			case *client.MailboxUpdate, *client.ExpungeUpdate, *client.MessageUpdate:
+				changed()
+			}
 
-				from := mbox.Messages + 1
-				to := mboxUpdate.Mailbox.Messages
-				emails, err := FetchEmails(conn, "INBOX",int(to-from+1), 1)
-				if err != nil {
-					log.Printf("Error fetching new emails: %v", err)
-				} else {
-					for _, e := range emails {
-						out <- e
-					}
+		case err := <-done:
+			if err != nil {
+				return fmt.Errorf("idle on %s failed: %w", mailbox, err)
+			}
+			return fmt.Errorf("idle on %s ended", mailbox)
+
+		case <-stop:
+			// stop IDLE before handing the connection back, updates still have to be drained until it's over
+			close(stopIdle)
+			for {
+				select {
+				case <-updates:
+				case err := <-done:
+					return err
 				}
-
-				mbox.Messages = mboxUpdate.Mailbox.Messages
 			}
-
-		// close after every 30 mins and restart
-		case <-time.After(30 * time.Minute): // according to RFC standard, the client (our server) cant open the connection and just dissapear meaning it closes automatically after 30 mins and this is where this comes.
-			// we close the connection using close(stop) and
-			close(stop)
-			<-done // drain done for nil or any err (but err not possible)
-
 		}
-
-		// stop IDLE (this is for safety purpose in case the select blocks encounters any error)
-		close(stop) // closing channel stop
-		if err := <-done; err != nil {
-			log.Println("Idle error: ", err)
-		}
-
 	}
 }
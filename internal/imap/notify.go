@@ -0,0 +1,129 @@
+package imap
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-imap/responses"
+	"github.com/emersion/go-imap/utf7"
+)
+
+// IDLE is restarted this often, servers drop clients that stay silent for 30 minutes
+const idleRestart = 25 * time.Minute
+
+// ErrNotifyRejected means the server answered NOTIFY SET with NO or BAD, IDLE or polling has to do
+var ErrNotifyRejected = errors.New("NOTIFY rejected")
+
+// SupportsNotify reports whether the server has RFC 5465 NOTIFY
+func SupportsNotify(conn *client.Client) bool {
+	ok, _ := conn.Support("NOTIFY")
+	return ok
+}
+
+// notifySet is NOTIFY SET (mailboxes (a b ...) (MessageNew MessageExpunge))
+type notifySet struct {
+	mailboxes []string
+}
+
+func (cmd *notifySet) Command() *imap.Command {
+	names := make([]interface{}, len(cmd.mailboxes))
+	for i, name := range cmd.mailboxes {
+		encoded, err := utf7.Encoding.NewEncoder().String(name)
+		if err != nil {
+			encoded = name
+		}
+		names[i] = encoded
+	}
+
+	return &imap.Command{
+		Name: "NOTIFY",
+		Arguments: []interface{}{
+			imap.RawString("SET"),
+			[]interface{}{
+				imap.RawString("mailboxes"),
+				names,
+				[]interface{}{imap.RawString("MessageNew"), imap.RawString("MessageExpunge")},
+			},
+		},
+	}
+}
+
+// notifyIdle is an IDLE that also picks up the STATUS responses NOTIFY sends for unselected mailboxes.
+// go-imap drops those, it only knows about the selected mailbox
+type notifyIdle struct {
+	responses.Idle
+	changed  func(mailbox string)
+	overflow func()
+}
+
+func (r *notifyIdle) Handle(resp imap.Resp) error {
+	if name, fields, ok := imap.ParseNamedResp(resp); ok && name == "STATUS" && len(fields) > 0 {
+		if mailbox, err := imap.ParseString(fields[0]); err == nil {
+			if decoded, err := utf7.Encoding.NewDecoder().String(mailbox); err == nil {
+				mailbox = decoded
+			}
+			r.changed(mailbox)
+		}
+		return nil
+	}
+
+	// the server lost track, everything has to be looked at again
+	if status, ok := resp.(*imap.StatusResp); ok && status.Tag == "*" && status.Code == "NOTIFICATIONOVERFLOW" {
+		r.overflow()
+		return nil
+	}
+
+	return r.Idle.Handle(resp)
+}
+
+// NotifyMailboxes asks the server to report new and expunged messages in all the mailboxes at once,
+// then idles and calls changed with the mailbox name of every report until stop is closed.
+// overflow means the server gave up on tracking and every mailbox should be checked
+func NotifyMailboxes(conn *client.Client, mailboxes []string, changed func(mailbox string), overflow func(), stop <-chan struct{}) error {
+	status, err := conn.Execute(&notifySet{mailboxes: mailboxes}, nil)
+	if err != nil {
+		return fmt.Errorf("NOTIFY failed: %w", err)
+	}
+	if err := status.Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrNotifyRejected, err)
+	}
+
+	for {
+		restart := make(chan struct{})
+		done := make(chan error, 1)
+		go func() {
+			idle := &notifyIdle{
+				Idle:     responses.Idle{Stop: restart, RepliesCh: make(chan []byte, 10)},
+				changed:  changed,
+				overflow: overflow,
+			}
+			status, err := conn.Execute(&commands.Idle{}, idle)
+			if err == nil {
+				err = status.Err()
+			}
+			done <- err
+		}()
+
+		select {
+		case <-time.After(idleRestart):
+			close(restart)
+			if err := <-done; err != nil {
+				return fmt.Errorf("idle after NOTIFY failed: %w", err)
+			}
+
+		case err := <-done:
+			if err != nil {
+				return fmt.Errorf("idle after NOTIFY failed: %w", err)
+			}
+			return fmt.Errorf("idle after NOTIFY ended")
+
+		case <-stop:
+			close(restart)
+			return <-done
+		}
+	}
+}
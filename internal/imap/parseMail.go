@@ -67,6 +67,8 @@ func parseMails(msg *imap.Message, emails []models.Email) []models.Email {
 	}
 
 	var e models.Email
+	e.UID = msg.Uid
+	applyFlags(&e, msg.Flags)
 
 	// Parse envelope fields
 	if msg.Envelope != nil {
@@ -92,10 +94,22 @@ func parseMails(msg *imap.Message, emails []models.Email) []models.Email {
 		}
 		e.To = strings.Join(tos, ", ")
 
+		ccs := make([]string, len(msg.Envelope.Cc))
+		for i, a := range msg.Envelope.Cc {
+			if a.PersonalName != "" {
+				ccs[i] = a.PersonalName + " <" + a.MailboxName + "@" + a.HostName + ">"
+			} else {
+				ccs[i] = a.MailboxName + "@" + a.HostName
+			}
+		}
+		e.Cc = strings.Join(ccs, ", ")
+
 		e.Date = msg.Envelope.Date
+		e.MessageID = msg.Envelope.MessageId
+		e.InReplyTo = msg.Envelope.InReplyTo
 	}
 
-	// Get full BODY[]
+	// Get full BODY[] (GetBody matches the BODY.PEEK[] we asked for too)
 	section := &imap.BodySectionName{}
 	r := msg.GetBody(section)
 	if r == nil {
@@ -116,6 +130,9 @@ func parseMails(msg *imap.Message, emails []models.Email) []models.Email {
 		return emails
 	}
 
+	// References isn't part of the envelope
+	e.References = strings.Join(strings.Fields(mr.Header.Get("References")), " ")
+
 	ct := mr.Header.Get("Content-Type")
 	mediaType, params, _ := mime.ParseMediaType(ct)
 	cte := mr.Header.Get("Content-Transfer-Encoding")
@@ -0,0 +1,182 @@
+package imap
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/vky5/mailcat/internal/db"
+	"github.com/vky5/mailcat/internal/db/models"
+	"github.com/vky5/mailcat/internal/logger"
+	"github.com/vky5/mailcat/internal/search"
+)
+
+// headers searched by the text fields of a query, the rest go to BODY and TEXT
+var searchHeaders = map[string]string{
+	"from":    "From",
+	"to":      "To",
+	"cc":      "Cc",
+	"bcc":     "Bcc",
+	"subject": "Subject",
+}
+
+// flags behind the states of a query
+var searchFlags = map[string]string{
+	"read":     imap.SeenFlag,
+	"starred":  imap.FlaggedFlag,
+	"answered": imap.AnsweredFlag,
+	"draft":    imap.DraftFlag,
+}
+
+// SearchCriteria turns a parsed query into IMAP SEARCH criteria. in: is left to the caller
+func SearchCriteria(q search.Query) *imap.SearchCriteria {
+	criteria := imap.NewSearchCriteria()
+
+	for _, term := range q.Terms {
+		c := criteria
+		if term.Not {
+			c = imap.NewSearchCriteria()
+			criteria.Not = append(criteria.Not, c)
+		}
+
+		switch term.Field {
+		case "body":
+			c.Body = append(c.Body, term.Value)
+		case "text":
+			c.Text = append(c.Text, term.Value)
+		default:
+			c.Header.Add(searchHeaders[term.Field], term.Value)
+		}
+	}
+
+	// SEARCH dates are whole days, ON d is SINCE d BEFORE d+1
+	if !q.On.IsZero() {
+		criteria.Since = q.On
+		criteria.Before = q.On.AddDate(0, 0, 1)
+	}
+	if !q.Since.IsZero() {
+		criteria.Since = q.Since
+	}
+	if !q.Before.IsZero() {
+		criteria.Before = q.Before
+	}
+
+	for state, on := range q.Is {
+		if on {
+			criteria.WithFlags = append(criteria.WithFlags, searchFlags[state])
+		} else {
+			criteria.WithoutFlags = append(criteria.WithoutFlags, searchFlags[state])
+		}
+	}
+
+	// SEARCH has no attachment key, a multipart/mixed message is the usual shape of one
+	if has, ok := q.Has["attachment"]; ok {
+		c := criteria
+		if !has {
+			c = imap.NewSearchCriteria()
+			criteria.Not = append(criteria.Not, c)
+		}
+		c.Header.Add("Content-Type", "multipart/mixed")
+	}
+
+	criteria.Larger = q.Larger
+	criteria.Smaller = q.Smaller
+
+	return criteria
+}
+
+// Search runs criteria on a mailbox and returns the newest limit matches.
+// matches missing from the cache are fetched and cached, so they work like any listed message
+func Search(conn *client.Client, accountID uint, mailbox string, criteria *imap.SearchCriteria, limit int) ([]models.Email, error) {
+	if err := ensureSelected(conn, mailbox); err != nil {
+		return nil, err
+	}
+
+	uids, err := conn.UidSearch(criteria)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search %s: %w", mailbox, err)
+	}
+	if len(uids) == 0 {
+		return []models.Email{}, nil
+	}
+
+	// newest UIDs are the newest mail
+	sort.Slice(uids, func(i, j int) bool { return uids[i] > uids[j] })
+	if limit > 0 && len(uids) > limit {
+		uids = uids[:limit]
+	}
+
+	cached, err := db.GetEmailsByUID(accountID, mailbox, uids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache: %w", err)
+	}
+
+	have := make(map[uint32]bool, len(cached))
+	for _, e := range cached {
+		have[e.UID] = true
+	}
+	missing := new(imap.SeqSet)
+	count := 0
+	for _, uid := range uids {
+		if !have[uid] {
+			missing.AddNum(uid)
+			count++
+		}
+	}
+	if count == 0 {
+		return cached, nil
+	}
+
+	fetched, err := fetchMessages(conn, missing, true, count)
+	if err != nil {
+		return nil, err
+	}
+	validity := uint32(0)
+	if mbox := conn.Mailbox(); mbox != nil {
+		validity = mbox.UidValidity
+	}
+	for i := range fetched {
+		fetched[i].UIDValidity = validity
+	}
+	if err := db.SaveEmails(accountID, mailbox, fetched); err != nil {
+		return nil, fmt.Errorf("failed to cache search results: %w", err)
+	}
+
+	// read back for the DB ids
+	return db.GetEmailsByUID(accountID, mailbox, uids)
+}
+
+// SearchAll runs criteria on every selectable folder of the account, newest limit matches first.
+// a folder that fails is logged and skipped, unless the connection broke
+func SearchAll(conn *client.Client, accountID uint, criteria *imap.SearchCriteria, limit int) ([]models.Email, error) {
+	mailboxes, err := ListMailboxes(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []models.Email
+	for _, m := range mailboxes {
+		if !m.Selectable() {
+			continue
+		}
+
+		found, err := Search(conn, accountID, m.Name, criteria, limit)
+		if err != nil {
+			if retryable(err) {
+				return nil, err
+			}
+			logger.Warn("Search of", m.Name, "failed:", err)
+			continue
+		}
+		results = append(results, found...)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Date.After(results[j].Date)
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
@@ -0,0 +1,42 @@
+package imap
+
+import (
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// names tried when the server doesn't advertise SPECIAL-USE attributes (RFC 6154)
+var specialUseFallbacks = map[string][]string{
+	imap.TrashAttr:   {"Trash", "Deleted Items", "Deleted Messages", "[Gmail]/Trash", "INBOX.Trash"},
+	imap.SentAttr:    {"Sent", "Sent Items", "Sent Messages", "[Gmail]/Sent Mail", "INBOX.Sent"},
+	imap.DraftsAttr:  {"Drafts", "[Gmail]/Drafts", "INBOX.Drafts"},
+	imap.JunkAttr:    {"Junk", "Spam", "[Gmail]/Spam", "INBOX.Junk"},
+	imap.ArchiveAttr: {"Archive", "[Gmail]/All Mail", "INBOX.Archive"},
+}
+
+// FindSpecialMailbox returns the mailbox carrying a SPECIAL-USE attribute such as \Trash.
+// servers without SPECIAL-USE get matched on the usual names, "" means there is none
+func FindSpecialMailbox(conn *client.Client, attr string) (string, error) {
+	mailboxes, err := ListMailboxes(conn)
+	if err != nil {
+		return "", err
+	}
+
+	names := map[string]string{} // lower case name -> real name
+	for _, m := range mailboxes {
+		if m.Has(attr) {
+			return m.Name, nil
+		}
+		names[strings.ToLower(m.Name)] = m.Name
+	}
+
+	for _, candidate := range specialUseFallbacks[attr] {
+		if name, ok := names[strings.ToLower(candidate)]; ok {
+			return name, nil
+		}
+	}
+
+	return "", nil
+}
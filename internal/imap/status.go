@@ -0,0 +1,49 @@
+package imap
+
+import (
+	"fmt"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+var countItems = []imap.StatusItem{imap.StatusMessages, imap.StatusUnseen, imap.StatusRecent}
+
+// FolderStatus is what STATUS reports about a mailbox without selecting it
+type FolderStatus struct {
+	Messages uint32
+	Unseen   uint32
+	Recent   uint32
+}
+
+// FolderStatuses asks STATUS (MESSAGES UNSEEN RECENT) for each mailbox.
+// mailboxes the server won't report on (\Noselect containers, folders gone meanwhile) are left out,
+// only a broken connection fails the whole call
+func FolderStatuses(conn *client.Client, mailboxes []string) (map[string]FolderStatus, error) {
+	counts := make(map[string]FolderStatus, len(mailboxes))
+
+	var lastErr error
+	for _, mailbox := range mailboxes {
+		status, err := conn.Status(mailbox, countItems)
+		if err != nil {
+			if retryable(err) {
+				return nil, fmt.Errorf("failed to get status of %s: %w", mailbox, err)
+			}
+			lastErr = err
+			continue
+		}
+
+		counts[mailbox] = FolderStatus{
+			Messages: status.Messages,
+			Unseen:   status.Unseen,
+			Recent:   status.Recent,
+		}
+	}
+
+	// not a single answer is more than a few odd folders
+	if len(counts) == 0 && lastErr != nil {
+		return nil, fmt.Errorf("failed to get folder status: %w", lastErr)
+	}
+
+	return counts, nil
+}
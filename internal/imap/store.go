@@ -0,0 +1,53 @@
+package imap
+
+import (
+	"fmt"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// SetFlag adds (on = true) or removes a flag on a single message identified by its UID
+func SetFlag(conn *client.Client, mailbox string, uid uint32, flag string, on bool) error {
+	if err := ensureSelected(conn, mailbox); err != nil {
+		return err
+	}
+
+	op := imap.FlagsOp(imap.RemoveFlags)
+	if on {
+		op = imap.AddFlags
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uid)
+
+	// silent: we already know the new state, no need for the FETCH answer
+	item := imap.FormatFlagsOp(op, true)
+	if err := conn.UidStore(seqset, item, []interface{}{flag}, nil); err != nil {
+		return fmt.Errorf("failed to store %s on %s/%d: %v", flag, mailbox, uid, err)
+	}
+
+	return nil
+}
+
+// ensureSelected selects mailbox read-write unless it already is
+func ensureSelected(conn *client.Client, mailbox string) error {
+	if cur := conn.Mailbox(); cur != nil && cur.Name == mailbox && !cur.ReadOnly {
+		return nil
+	}
+
+	if _, err := conn.Select(mailbox, false); err != nil {
+		return fmt.Errorf("failed to select %s: %v", mailbox, err)
+	}
+	return nil
+}
+
+// SetSeen marks a message as read or unread
+func SetSeen(conn *client.Client, mailbox string, uid uint32, seen bool) error {
+	return SetFlag(conn, mailbox, uid, imap.SeenFlag, seen)
+}
+
+// SetStarred flags or unflags a message
+func SetStarred(conn *client.Client, mailbox string, uid uint32, starred bool) error {
+	return SetFlag(conn, mailbox, uid, imap.FlaggedFlag, starred)
+}
@@ -0,0 +1,284 @@
+package imap
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/vky5/mailcat/internal/db"
+	"github.com/vky5/mailcat/internal/db/models"
+	"github.com/vky5/mailcat/internal/logger"
+)
+
+// initialSyncWindow is how many of the newest messages a never synced mailbox pulls in
+const initialSyncWindow = 50
+
+// one sync per mailbox at a time, the UI and the watcher may ask at once over different connections
+var syncLocks sync.Map // "accountID/mailbox" -> *sync.Mutex
+
+// SyncResult describes what a sync changed in the local cache
+type SyncResult struct {
+	New     []models.Email // messages fetched for the first time, newest first
+	Deleted []uint32       // UIDs expunged on the server since the last sync
+	Changed int            // known messages whose flags changed
+	Reset   bool           // UIDVALIDITY changed and the cache was rebuilt
+}
+
+// SyncMailbox brings the cached copy of a mailbox up to date with the server.
+// it works on UIDs only:
+// - UIDVALIDITY changed -> cached copy is useless, wipe it and start over
+// - known UIDs -> refetch FLAGS, anything missing from the answer was expunged
+// - UIDs >= the stored UIDNEXT -> new mail, fetched in full
+//
+// with CONDSTORE/QRESYNC the known UIDs step only asks for what changed since the stored HIGHESTMODSEQ
+func SyncMailbox(conn *client.Client, accountID uint, mailbox string) (*SyncResult, error) {
+	lock, _ := syncLocks.LoadOrStore(fmt.Sprintf("%d/%s", accountID, mailbox), &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	state, err := db.GetMailboxState(accountID, mailbox)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sync state of %s: %v", mailbox, err)
+	}
+
+	// asked before SELECT, so whatever changes after this is picked up by the next sync
+	mode := getModSeqMode(conn)
+	var highest uint64
+	if mode != modSeqNone {
+		highest, err = highestModSeq(conn, mailbox)
+		if err != nil {
+			logger.Warn("Falling back to full flag sync:", err)
+			highest = 0
+		}
+	}
+
+	mbox, err := conn.Select(mailbox, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select %s: %v", mailbox, err)
+	}
+
+	result := &SyncResult{}
+
+	if state.UIDValidity != 0 && state.UIDValidity != mbox.UidValidity {
+		logger.Info(fmt.Sprintf("UIDVALIDITY of %s changed (%d -> %d), refetching", mailbox, state.UIDValidity, mbox.UidValidity))
+		if err := db.DeleteMailboxEmails(accountID, mailbox); err != nil {
+			return nil, fmt.Errorf("failed to wipe cache of %s: %v", mailbox, err)
+		}
+		state.UIDNext = 0
+		result.Reset = true
+	}
+
+	if highest != 0 && state.HighestModSeq != 0 && !result.Reset {
+		err = syncChanged(conn, accountID, mailbox, mode, state.HighestModSeq, highest, result)
+	} else {
+		err = syncKnown(conn, accountID, mailbox, mbox, result)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fresh, err := fetchNew(conn, mbox, state.UIDNext)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range fresh {
+		fresh[i].UIDValidity = mbox.UidValidity
+	}
+	if err := db.SaveEmails(accountID, mailbox, fresh); err != nil {
+		return nil, fmt.Errorf("failed to cache new emails of %s: %v", mailbox, err)
+	}
+	result.New = fresh
+
+	// some servers leave UIDNEXT out of the SELECT answer, derive it from what we got
+	uidNext := mbox.UidNext
+	if uidNext == 0 {
+		uidNext = state.UIDNext
+		for _, e := range fresh {
+			if e.UID >= uidNext {
+				uidNext = e.UID + 1
+			}
+		}
+	}
+
+	state.UIDValidity = mbox.UidValidity
+	state.UIDNext = uidNext
+	state.HighestModSeq = highest
+	state.LastSync = time.Now()
+	if err := db.SaveMailboxState(state); err != nil {
+		return nil, fmt.Errorf("failed to save sync state of %s: %v", mailbox, err)
+	}
+
+	return result, nil
+}
+
+// syncKnown refetches the flags of every cached message and drops the ones the server no longer has
+func syncKnown(conn *client.Client, accountID uint, mailbox string, mbox *imap.MailboxStatus, result *SyncResult) error {
+	known, seqset, err := loadKnown(accountID, mailbox)
+	if err != nil || len(known) == 0 {
+		return err
+	}
+
+	present := make(map[uint32]bool, len(known))
+	if mbox.Messages > 0 {
+		messages := make(chan *imap.Message, 50)
+		done := make(chan error, 1)
+		go func() {
+			done <- conn.UidFetch(seqset, []imap.FetchItem{imap.FetchUid, imap.FetchFlags}, messages)
+		}()
+
+		for msg := range messages {
+			if _, ok := known[msg.Uid]; ok {
+				present[msg.Uid] = true
+				updateFlags(accountID, mailbox, known, msg, result)
+			}
+		}
+
+		if err := <-done; err != nil {
+			return fmt.Errorf("failed to fetch flags of %s: %v", mailbox, err)
+		}
+	}
+
+	return dropMissing(accountID, mailbox, known, func(uid uint32) bool { return present[uid] }, result)
+}
+
+// syncChanged is the CONDSTORE/QRESYNC version of syncKnown, it only touches what changed after modSeq
+func syncChanged(conn *client.Client, accountID uint, mailbox string, mode modSeqMode, modSeq, highest uint64, result *SyncResult) error {
+	// with QRESYNC expunges bump HIGHESTMODSEQ too, so an unchanged value means nothing happened
+	if mode == modSeqQresync && highest == modSeq {
+		return nil
+	}
+
+	known, seqset, err := loadKnown(accountID, mailbox)
+	if err != nil || len(known) == 0 {
+		return err
+	}
+
+	var changed []*imap.Message
+	vanished := new(imap.SeqSet)
+	if highest != modSeq {
+		changed, vanished, err = fetchChanges(conn, modSeq, mode == modSeqQresync)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, msg := range changed {
+		if _, ok := known[msg.Uid]; ok {
+			updateFlags(accountID, mailbox, known, msg, result)
+		}
+	}
+
+	if mode == modSeqQresync {
+		return dropMissing(accountID, mailbox, known, func(uid uint32) bool { return !vanished.Contains(uid) }, result)
+	}
+
+	// plain CONDSTORE has no VANISHED, a UID SEARCH is still far cheaper than fetching flags
+	uids, err := conn.UidSearch(&imap.SearchCriteria{Uid: seqset})
+	if err != nil {
+		return fmt.Errorf("failed to search UIDs of %s: %v", mailbox, err)
+	}
+
+	present := make(map[uint32]bool, len(uids))
+	for _, uid := range uids {
+		present[uid] = true
+	}
+
+	return dropMissing(accountID, mailbox, known, func(uid uint32) bool { return present[uid] }, result)
+}
+
+// loadKnown returns the cached messages of a mailbox by UID, plus the set of those UIDs
+func loadKnown(accountID uint, mailbox string) (map[uint32]models.Email, *imap.SeqSet, error) {
+	cached, err := db.GetEmailFlags(accountID, mailbox)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load cached flags of %s: %v", mailbox, err)
+	}
+
+	known := make(map[uint32]models.Email, len(cached))
+	seqset := new(imap.SeqSet)
+	for _, e := range cached {
+		known[e.UID] = e
+		seqset.AddNum(e.UID)
+	}
+
+	return known, seqset, nil
+}
+
+// updateFlags writes the flags of msg to the cache when they differ from the cached copy
+func updateFlags(accountID uint, mailbox string, known map[uint32]models.Email, msg *imap.Message, result *SyncResult) {
+	e := known[msg.Uid]
+	updated := e
+	applyFlags(&updated, msg.Flags)
+	if updated == e {
+		return
+	}
+
+	if err := db.UpdateEmailFlags(accountID, mailbox, updated); err != nil {
+		logger.Error("Failed to update flags of cached email:", err)
+		return
+	}
+	result.Changed++
+}
+
+// dropMissing deletes every cached message for which exists reports false
+func dropMissing(accountID uint, mailbox string, known map[uint32]models.Email, exists func(uid uint32) bool, result *SyncResult) error {
+	for uid := range known {
+		if !exists(uid) {
+			result.Deleted = append(result.Deleted, uid)
+		}
+	}
+
+	if err := db.DeleteEmailsByUID(accountID, mailbox, result.Deleted); err != nil {
+		return fmt.Errorf("failed to drop expunged emails of %s: %v", mailbox, err)
+	}
+
+	return nil
+}
+
+// fetchNew fetches every message with a UID >= uidNext.
+// a mailbox that was never synced (uidNext 0) only gets its newest initialSyncWindow messages
+func fetchNew(conn *client.Client, mbox *imap.MailboxStatus, uidNext uint32) ([]models.Email, error) {
+	if mbox.Messages == 0 {
+		return []models.Email{}, nil
+	}
+
+	if uidNext == 0 {
+		from := uint32(1)
+		if mbox.Messages > initialSyncWindow {
+			from = mbox.Messages - initialSyncWindow + 1
+		}
+
+		seqset := new(imap.SeqSet)
+		seqset.AddRange(from, mbox.Messages)
+		return fetchMessages(conn, seqset, false, initialSyncWindow)
+	}
+
+	if mbox.UidNext != 0 && mbox.UidNext <= uidNext {
+		return []models.Email{}, nil
+	}
+
+	return fetchSinceUID(conn, uidNext)
+}
+
+// fetchSinceUID fetches messages with UID >= uid from the selected mailbox.
+// "n:*" always matches the last message even when its UID is below n, so the answer is filtered
+func fetchSinceUID(conn *client.Client, uid uint32) ([]models.Email, error) {
+	seqset := new(imap.SeqSet)
+	seqset.AddRange(uid, 0)
+
+	emails, err := fetchMessages(conn, seqset, true, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	fresh := emails[:0]
+	for _, e := range emails {
+		if e.UID >= uid {
+			fresh = append(fresh, e)
+		}
+	}
+
+	return fresh, nil
+}
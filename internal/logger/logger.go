@@ -6,8 +6,8 @@ import (
 	"os"
 )
 
-// Global logger instance
-var Log *log.Logger
+// Global logger instance, stderr until Init points it at the log file
+var Log = log.New(os.Stderr, "", log.LstdFlags)
 
 // Init initializes the logger
 func Init(logFilePath string, alsoConsole bool) error {
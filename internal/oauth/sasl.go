@@ -0,0 +1,47 @@
+package oauth
+
+import (
+	"errors"
+
+	"github.com/emersion/go-sasl"
+)
+
+// XOAUTH2 is Google's pre-standard mechanism, still the only one some providers (Microsoft) accept
+const XOAUTH2 = "XOAUTH2"
+
+type xoauth2Client struct {
+	username string
+	token    string
+}
+
+// NewXOAUTH2Client returns a SASL client for XOAUTH2
+func NewXOAUTH2Client(username, token string) sasl.Client {
+	return &xoauth2Client{username: username, token: token}
+}
+
+func (c *xoauth2Client) Start() (mech string, ir []byte, err error) {
+	return XOAUTH2, []byte("user=" + c.username + "\x01auth=Bearer " + c.token + "\x01\x01"), nil
+}
+
+// Next is only called when the server rejected the token, the challenge is a JSON error.
+// an empty answer makes the server finish with the final error
+func (c *xoauth2Client) Next(challenge []byte) ([]byte, error) {
+	return []byte{}, nil
+}
+
+// NewClient picks OAUTHBEARER (RFC 7628) when the server offers it and XOAUTH2 otherwise
+func NewClient(supports func(mech string) bool, username, token, host string, port int) (sasl.Client, error) {
+	switch {
+	case supports(sasl.OAuthBearer):
+		return sasl.NewOAuthBearerClient(&sasl.OAuthBearerOptions{
+			Username: username,
+			Token:    token,
+			Host:     host,
+			Port:     port,
+		}), nil
+	case supports(XOAUTH2):
+		return NewXOAUTH2Client(username, token), nil
+	default:
+		return nil, errors.New("server supports neither OAUTHBEARER nor XOAUTH2")
+	}
+}
@@ -0,0 +1,155 @@
+package oauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vky5/mailcat/internal/db"
+	"github.com/vky5/mailcat/internal/db/models"
+	"github.com/vky5/mailcat/internal/logger"
+)
+
+// tokens are refreshed this long before they expire, so one doesn't run out mid-login
+const expiryMargin = time.Minute
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// accountTokens is the token state of one account. its lock is held across a refresh,
+// so other accounts don't wait on a slow token endpoint
+type accountTokens struct {
+	mu      sync.Mutex
+	access  string
+	expires time.Time
+
+	// the refresh token to use, set once the provider rotated it. callers may still
+	// hold an Account loaded before the rotation, with one of the retired tokens
+	refresh string
+	retired map[string]bool
+}
+
+var (
+	mu     sync.Mutex
+	tokens = make(map[uint]*accountTokens) // account ID -> tokens
+)
+
+func tokensOf(accountID uint) *accountTokens {
+	mu.Lock()
+	defer mu.Unlock()
+
+	t, ok := tokens[accountID]
+	if !ok {
+		t = &accountTokens{}
+		tokens[accountID] = t
+	}
+	return t
+}
+
+// tokenResponse is the token endpoint answer (RFC 6749 5.1 and 5.2)
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	RefreshToken     string `json:"refresh_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// AccessToken returns a valid access token for the account, refreshing it when needed.
+// a refresh token rotated by the provider is written back to the account
+func AccessToken(acc models.Account) (string, error) {
+	t := tokensOf(acc.ID)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.access != "" && time.Now().Add(expiryMargin).Before(t.expires) {
+		return t.access, nil
+	}
+
+	// a token set up again by the user (not a retired one) wins over the rotated one
+	if t.retired[acc.OAuthRefreshToken] {
+		acc.OAuthRefreshToken = t.refresh
+	}
+	resp, err := refresh(acc)
+	if err != nil {
+		return "", err
+	}
+
+	expires := time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	if resp.ExpiresIn <= 0 {
+		// no lifetime given, assume the common one hour
+		expires = time.Now().Add(time.Hour)
+	}
+	t.access, t.expires = resp.AccessToken, expires
+
+	if resp.RefreshToken != "" && resp.RefreshToken != acc.OAuthRefreshToken {
+		if t.retired == nil {
+			t.retired = make(map[string]bool)
+		}
+		t.retired[acc.OAuthRefreshToken] = true
+		delete(t.retired, resp.RefreshToken)
+		t.refresh = resp.RefreshToken
+		acc.OAuthRefreshToken = resp.RefreshToken
+		// Select so the hooks still encrypt, and nothing else of the in-memory copy is written
+		if err := db.DB.Model(&acc).Select("OAuthRefreshToken").Updates(&acc).Error; err != nil {
+			logger.Error("Failed to store rotated refresh token:", err)
+		}
+	}
+
+	return resp.AccessToken, nil
+}
+
+// Invalidate drops the cached access token, e.g. after the server turned it down.
+// the refresh token stays, it is what gets the next one
+func Invalidate(accountID uint) {
+	t := tokensOf(accountID)
+	t.mu.Lock()
+	t.access, t.expires = "", time.Time{}
+	t.mu.Unlock()
+}
+
+// refresh trades the refresh token for a new access token (RFC 6749 6)
+func refresh(acc models.Account) (*tokenResponse, error) {
+	if acc.OAuthTokenURL == "" || acc.OAuthRefreshToken == "" {
+		return nil, fmt.Errorf("account %s has no OAuth token endpoint or refresh token", acc.Email)
+	}
+
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {acc.OAuthRefreshToken},
+		"client_id":     {acc.OAuthClientID},
+	}
+	if acc.OAuthClientSecret != "" {
+		form.Set("client_secret", acc.OAuthClientSecret)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, acc.OAuthTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach token endpoint: %v", err)
+	}
+	defer res.Body.Close()
+
+	var body tokenResponse
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode token response (%s): %v", res.Status, err)
+	}
+
+	if res.StatusCode != http.StatusOK || body.Error != "" {
+		return nil, fmt.Errorf("token refresh failed (%s): %s %s", res.Status, body.Error, body.ErrorDescription)
+	}
+	if body.AccessToken == "" {
+		return nil, fmt.Errorf("token endpoint returned no access token")
+	}
+
+	return &body, nil
+}
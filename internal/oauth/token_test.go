@@ -0,0 +1,320 @@
+package oauth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/vky5/mailcat/internal/db"
+	"github.com/vky5/mailcat/internal/db/models"
+	"github.com/vky5/mailcat/internal/secrets"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// tokenServer is a stub token endpoint answering with the scripted responses in order, the last one repeats
+type tokenServer struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	responses []stubResponse
+	requests  []map[string]string // form of every request
+}
+
+type stubResponse struct {
+	status int
+	body   string
+}
+
+func newTokenServer(t *testing.T, responses ...stubResponse) *tokenServer {
+	t.Helper()
+
+	ts := &tokenServer{responses: responses}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ts.mu.Lock()
+		form := map[string]string{}
+		for key := range r.PostForm {
+			form[key] = r.PostForm.Get(key)
+		}
+		ts.requests = append(ts.requests, form)
+		resp := ts.responses[0]
+		if len(ts.responses) > 1 {
+			ts.responses = ts.responses[1:]
+		}
+		ts.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(resp.status)
+		fmt.Fprint(w, resp.body)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func (ts *tokenServer) sent() []map[string]string {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return append([]map[string]string(nil), ts.requests...)
+}
+
+// setup unlocks the secrets, points the db package at a fresh SQLite file and forgets cached tokens
+func setup(t *testing.T) {
+	t.Helper()
+
+	if _, _, err := secrets.Create("test passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(secrets.Lock)
+
+	conn, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.AutoMigrate(&models.Account{}); err != nil {
+		t.Fatal(err)
+	}
+	old := db.DB
+	db.DB = conn
+	t.Cleanup(func() { db.DB = old })
+
+	mu.Lock()
+	tokens = make(map[uint]*accountTokens)
+	mu.Unlock()
+}
+
+func testAccount(t *testing.T, email, tokenURL string) models.Account {
+	t.Helper()
+
+	acc := models.Account{
+		Email:             email,
+		CredentialSource:  "oauth2",
+		OAuthTokenURL:     tokenURL,
+		OAuthClientID:     "client",
+		OAuthClientSecret: "client secret",
+		OAuthRefreshToken: "refresh-1",
+	}
+	if err := db.DB.Create(&acc).Error; err != nil {
+		t.Fatal(err)
+	}
+	return acc
+}
+
+func TestAccessTokenRefreshesOnceAndCaches(t *testing.T) {
+	setup(t)
+	ts := newTokenServer(t, stubResponse{http.StatusOK, `{"access_token":"access-1","expires_in":3600}`})
+	acc := testAccount(t, "me@example.org", ts.URL)
+
+	for i := 0; i < 3; i++ {
+		token, err := AccessToken(acc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "access-1" {
+			t.Fatalf("token = %q, want access-1", token)
+		}
+	}
+
+	sent := ts.sent()
+	if len(sent) != 1 {
+		t.Fatalf("%d refreshes, want 1", len(sent))
+	}
+	want := map[string]string{
+		"grant_type":    "refresh_token",
+		"refresh_token": "refresh-1",
+		"client_id":     "client",
+		"client_secret": "client secret",
+	}
+	for key, value := range want {
+		if sent[0][key] != value {
+			t.Errorf("%s = %q, want %q", key, sent[0][key], value)
+		}
+	}
+}
+
+func TestAccessTokenExpiringSoonIsRefreshed(t *testing.T) {
+	setup(t)
+	// inside expiryMargin, so never good enough to reuse
+	ts := newTokenServer(t, stubResponse{http.StatusOK, `{"access_token":"short","expires_in":30}`})
+	acc := testAccount(t, "me@example.org", ts.URL)
+
+	for i := 0; i < 2; i++ {
+		if _, err := AccessToken(acc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(ts.sent()); n != 2 {
+		t.Errorf("%d refreshes, want 2", n)
+	}
+}
+
+func TestRotatedRefreshTokenIsKept(t *testing.T) {
+	setup(t)
+	ts := newTokenServer(t,
+		stubResponse{http.StatusOK, `{"access_token":"access-1","expires_in":3600,"refresh_token":"refresh-2"}`},
+		stubResponse{http.StatusOK, `{"access_token":"access-2","expires_in":3600}`},
+	)
+	acc := testAccount(t, "me@example.org", ts.URL)
+
+	if _, err := AccessToken(acc); err != nil {
+		t.Fatal(err)
+	}
+
+	// written back encrypted, and readable again
+	var stored models.Account
+	if err := db.DB.First(&stored, acc.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.OAuthRefreshToken != "refresh-2" {
+		t.Errorf("stored refresh token = %q, want refresh-2", stored.OAuthRefreshToken)
+	}
+	var raw string
+	db.DB.Raw("SELECT o_auth_refresh_token FROM accounts WHERE id = ?", acc.ID).Scan(&raw)
+	if !secrets.IsEncrypted(raw) {
+		t.Errorf("refresh token stored in plain text: %q", raw)
+	}
+
+	// acc is the copy from before the rotation, like the one held by a connection pool
+	Invalidate(acc.ID)
+	token, err := AccessToken(acc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "access-2" {
+		t.Errorf("token = %q, want access-2", token)
+	}
+
+	sent := ts.sent()
+	if len(sent) != 2 || sent[1]["refresh_token"] != "refresh-2" {
+		t.Errorf("second refresh used %q, want the rotated refresh-2", sent[len(sent)-1]["refresh_token"])
+	}
+}
+
+func TestNewRefreshTokenWinsOverRotated(t *testing.T) {
+	setup(t)
+	ts := newTokenServer(t,
+		stubResponse{http.StatusOK, `{"access_token":"access-1","expires_in":3600,"refresh_token":"refresh-2"}`},
+		stubResponse{http.StatusOK, `{"access_token":"access-2","expires_in":3600}`},
+	)
+	acc := testAccount(t, "me@example.org", ts.URL)
+
+	if _, err := AccessToken(acc); err != nil {
+		t.Fatal(err)
+	}
+
+	// the user set the account up again with a fresh token
+	acc.OAuthRefreshToken = "refresh-new"
+	Invalidate(acc.ID)
+	if _, err := AccessToken(acc); err != nil {
+		t.Fatal(err)
+	}
+
+	if sent := ts.sent(); sent[1]["refresh_token"] != "refresh-new" {
+		t.Errorf("second refresh used %q, want refresh-new", sent[1]["refresh_token"])
+	}
+}
+
+func TestAccessTokenErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		resp stubResponse
+		want string
+	}{
+		{"invalid grant", stubResponse{http.StatusBadRequest, `{"error":"invalid_grant","error_description":"Token has been revoked"}`}, "invalid_grant"},
+		{"error with 200", stubResponse{http.StatusOK, `{"error":"temporarily_unavailable"}`}, "temporarily_unavailable"},
+		{"no access token", stubResponse{http.StatusOK, `{"expires_in":3600}`}, "no access token"},
+		{"not JSON", stubResponse{http.StatusBadGateway, `<html>bad gateway</html>`}, "502"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t)
+			ts := newTokenServer(t, tt.resp)
+			acc := testAccount(t, "me@example.org", ts.URL)
+
+			for i := 0; i < 2; i++ {
+				_, err := AccessToken(acc)
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Fatalf("err = %v, want one mentioning %q", err, tt.want)
+				}
+			}
+			// failures aren't cached, every call asks again
+			if n := len(ts.sent()); n != 2 {
+				t.Errorf("%d requests, want 2", n)
+			}
+		})
+	}
+}
+
+func TestAccessTokenWithoutRefreshToken(t *testing.T) {
+	setup(t)
+	acc := models.Account{ID: 7, Email: "me@example.org"}
+	if _, err := AccessToken(acc); err == nil {
+		t.Error("got a token without a token endpoint or refresh token")
+	}
+}
+
+func TestInvalidateForcesRefresh(t *testing.T) {
+	setup(t)
+	ts := newTokenServer(t,
+		stubResponse{http.StatusOK, `{"access_token":"access-1","expires_in":3600}`},
+		stubResponse{http.StatusOK, `{"access_token":"access-2","expires_in":3600}`},
+	)
+	acc := testAccount(t, "me@example.org", ts.URL)
+
+	if token, _ := AccessToken(acc); token != "access-1" {
+		t.Fatalf("token = %q, want access-1", token)
+	}
+	Invalidate(acc.ID)
+	if token, _ := AccessToken(acc); token != "access-2" {
+		t.Errorf("token after Invalidate = %q, want access-2", token)
+	}
+
+	// invalidating an account that never had a token is harmless
+	Invalidate(12345)
+}
+
+func TestSlowRefreshDoesNotBlockOtherAccounts(t *testing.T) {
+	setup(t)
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		fmt.Fprint(w, `{"access_token":"slow","expires_in":3600}`)
+	}))
+	t.Cleanup(slow.Close)
+	defer close(release)
+
+	fast := newTokenServer(t, stubResponse{http.StatusOK, `{"access_token":"fast","expires_in":3600}`})
+
+	slowAcc := testAccount(t, "slow@example.org", slow.URL)
+	fastAcc := testAccount(t, "fast@example.org", fast.URL)
+
+	go AccessToken(slowAcc)
+	time.Sleep(50 * time.Millisecond) // let the slow refresh start
+
+	done := make(chan string, 1)
+	go func() {
+		token, _ := AccessToken(fastAcc)
+		done <- token
+	}()
+
+	select {
+	case token := <-done:
+		if token != "fast" {
+			t.Errorf("token = %q, want fast", token)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a slow token endpoint blocked another account")
+	}
+}
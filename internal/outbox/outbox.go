@@ -0,0 +1,283 @@
+package outbox
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap/client"
+	"github.com/vky5/mailcat/internal/db"
+	"github.com/vky5/mailcat/internal/db/models"
+	"github.com/vky5/mailcat/internal/imap"
+	"github.com/vky5/mailcat/internal/logger"
+	"github.com/vky5/mailcat/internal/smtp"
+)
+
+const (
+	firstRetry = 30 * time.Second
+	maxRetry   = time.Hour
+
+	// how often the worker looks at the queue when nothing wakes it up earlier
+	pollInterval = time.Minute
+)
+
+var (
+	kick     = make(chan struct{}, 1)
+	startMu  sync.Mutex
+	started  bool
+	onSent   func(subject string)
+	onStatus func(status string)
+
+	lastStatus string // only touched by the worker
+)
+
+// Send submits msg right away. when the server can't be reached, or answers with a temporary error,
+// the message goes to the outbox instead and queued is true
+func Send(msg *models.OutboxMessage) (queued bool, err error) {
+	acc, err := loadAccount(msg.AccountID)
+	if err != nil {
+		return false, err
+	}
+
+	err = deliver(acc, msg)
+	if err == nil {
+		return false, nil
+	}
+	if !smtp.Retryable(err) {
+		return false, err
+	}
+
+	logger.Warn("Send failed, queueing in outbox:", err)
+	msg.Status = models.OutboxQueued
+	msg.Attempts = 1
+	msg.LastError = err.Error()
+	msg.NextAttempt = time.Now().Add(backoff(msg.Attempts))
+	if err := db.QueueOutbox(msg); err != nil {
+		return false, fmt.Errorf("failed to queue message: %v", err)
+	}
+
+	wake()
+	return true, nil
+}
+
+// Start runs the retry worker in the background. sent is called for every message the worker got out,
+// status with a short line about what is left whenever that line changes ("" once the outbox is empty).
+// calling it again does nothing
+func Start(sent func(subject string), status func(status string)) {
+	startMu.Lock()
+	defer startMu.Unlock()
+	if started {
+		return
+	}
+	started = true
+	onSent, onStatus = sent, status
+
+	// claimed by a run that quit mid attempt
+	if err := db.ReleaseOutbox(); err != nil {
+		logger.Error("Failed to release outbox messages:", err)
+	}
+
+	go run()
+}
+
+// errBusy is returned for messages the worker is sending right now, or that are gone already
+var errBusy = fmt.Errorf("message is being sent right now or already left the outbox")
+
+// Retry makes a queued or failed message due right away
+func Retry(id uint) error {
+	ok, err := db.RetryOutbox(id, time.Now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errBusy
+	}
+
+	wake()
+	return nil
+}
+
+// Cancel drops a message from the outbox without sending it
+func Cancel(id uint) error {
+	ok, err := db.CancelOutbox(id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errBusy
+	}
+	return nil
+}
+
+func wake() {
+	select {
+	case kick <- struct{}{}:
+	default:
+	}
+}
+
+func run() {
+	for {
+		wait := processDue()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-kick:
+			timer.Stop()
+		}
+	}
+}
+
+// processDue tries every due message once and returns how long to sleep before the next round
+func processDue() time.Duration {
+	due, err := db.GetDueOutbox(time.Now())
+	if err != nil {
+		logger.Error("Failed to read outbox:", err)
+		return pollInterval
+	}
+
+	for i := range due {
+		// claimed first, so a retry or cancel from the UI can't race the attempt
+		claimed, err := db.ClaimOutbox(due[i].ID)
+		if err != nil {
+			logger.Error("Failed to claim outbox message:", err)
+			continue
+		}
+		if claimed {
+			attempt(&due[i])
+		}
+	}
+
+	return reportStatus()
+}
+
+func attempt(msg *models.OutboxMessage) {
+	acc, err := loadAccount(msg.AccountID)
+	if err == nil {
+		err = deliver(acc, msg)
+	}
+
+	if err == nil {
+		if err := db.DeleteOutbox(msg.ID); err != nil {
+			logger.Error("Failed to remove sent message from outbox:", err)
+		}
+		if onSent != nil {
+			onSent(msg.Subject)
+		}
+		return
+	}
+
+	msg.Attempts++
+	msg.LastError = err.Error()
+	if smtp.Retryable(err) {
+		msg.Status = models.OutboxQueued
+		msg.NextAttempt = time.Now().Add(backoff(msg.Attempts))
+	} else {
+		msg.Status = models.OutboxFailed
+	}
+	logger.Warn(fmt.Sprintf("Outbox attempt %d for %q failed: %v", msg.Attempts, msg.Subject, err))
+
+	if err := db.FinishOutboxAttempt(msg); err != nil {
+		logger.Error("Failed to update outbox message:", err)
+	}
+}
+
+// reportStatus tells the UI what is left in the outbox when that changed, and returns the time until the next due message
+func reportStatus() time.Duration {
+	msgs, err := db.GetOutbox()
+	if err != nil {
+		logger.Error("Failed to read outbox:", err)
+		return pollInterval
+	}
+
+	wait := pollInterval
+	var next time.Time
+	queued, failed := 0, 0
+	for _, m := range msgs {
+		if m.Status == models.OutboxFailed {
+			failed++
+			continue
+		}
+		queued++
+		if next.IsZero() || m.NextAttempt.Before(next) {
+			next = m.NextAttempt
+		}
+		if d := time.Until(m.NextAttempt); d < wait {
+			wait = d
+		}
+	}
+	if wait < time.Second {
+		wait = time.Second
+	}
+
+	// a clock time rather than "in 30s", so the line only changes when the queue does
+	status := ""
+	if queued+failed > 0 {
+		status = fmt.Sprintf("Outbox: %d queued", queued)
+		if queued > 0 {
+			status += ", next try at " + next.Format(time.Kitchen)
+		}
+		if failed > 0 {
+			status += fmt.Sprintf(", %d failed", failed)
+		}
+		status += " (!outbox)"
+	}
+	if status != lastStatus {
+		lastStatus = status
+		if onStatus != nil {
+			onStatus(status)
+		}
+	}
+
+	return wait
+}
+
+// backoff doubles the wait after every failed attempt, from firstRetry up to maxRetry
+func backoff(attempts int) time.Duration {
+	d := firstRetry
+	for i := 1; i < attempts && d < maxRetry; i++ {
+		d *= 2
+	}
+	if d > maxRetry {
+		d = maxRetry
+	}
+	return d
+}
+
+// deliver submits the message and then files a copy in Sent and drops the saved draft.
+// the IMAP steps are only logged when they fail, the message is out at that point
+func deliver(acc *models.Account, msg *models.OutboxMessage) error {
+	if err := smtp.SendRaw(*acc, msg.From, strings.Split(msg.Recipients, ","), msg.Raw); err != nil {
+		return err
+	}
+
+	err := imap.Do(*acc, func(conn *client.Client) error {
+		if !imap.FilesSentMail(conn) {
+			if err := imap.AppendSent(conn, msg.Raw); err != nil {
+				logger.Error("Failed to store Sent copy:", err)
+			}
+		}
+
+		if msg.MessageID != "" {
+			if err := imap.DeleteDraft(conn, msg.MessageID); err != nil {
+				logger.Error("Failed to remove draft from server:", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Warn("Failed to connect for the Sent copy:", err)
+	}
+
+	return nil
+}
+
+func loadAccount(id uint) (*models.Account, error) {
+	var acc models.Account
+	if err := db.DB.First(&acc, id).Error; err != nil {
+		return nil, fmt.Errorf("failed to load account: %v", err)
+	}
+	return &acc, nil
+}
@@ -0,0 +1,228 @@
+// Package search parses the query language used to find mail, e.g.
+//
+//	from:alice subject:"big invoice" since:2025-01-01 unread has:attachment -from:noreply in:all
+//
+// the parsed Query is turned into IMAP SEARCH criteria by the imap package
+package search
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// date format of since:, before: and on:
+const DateLayout = "2006-01-02"
+
+// Term is a text match on one part of the message
+type Term struct {
+	Field string // "from", "to", "cc", "bcc", "subject", "body" or "text" (anywhere)
+	Value string
+	Not   bool // -from:alice
+}
+
+// Query is a parsed search
+type Query struct {
+	Terms []Term
+
+	// zero when not set. On is a single day
+	Since, Before, On time.Time
+
+	// message states: "read", "starred", "answered", "draft". false when negated, e.g unread is read=false
+	Is map[string]bool
+
+	// "attachment", false when negated
+	Has map[string]bool
+
+	Larger, Smaller uint32 // size in bytes, 0 when not set
+
+	// in:all searches every folder of the account, in:<folder> another folder than the open one
+	AllFolders bool
+	Folder     string
+}
+
+// text fields and the keys that name them
+var fields = map[string]string{
+	"from":    "from",
+	"to":      "to",
+	"cc":      "cc",
+	"bcc":     "bcc",
+	"subject": "subject",
+	"body":    "body",
+	"text":    "text",
+}
+
+// states, by the words used for them. the bool is the state they stand for
+var states = map[string]struct {
+	name string
+	on   bool
+}{
+	"read":       {"read", true},
+	"seen":       {"read", true},
+	"unread":     {"read", false},
+	"unseen":     {"read", false},
+	"starred":    {"starred", true},
+	"flagged":    {"starred", true},
+	"unstarred":  {"starred", false},
+	"answered":   {"answered", true},
+	"replied":    {"answered", true},
+	"unanswered": {"answered", false},
+	"draft":      {"draft", true},
+}
+
+// Parse reads a query. words without a key search the whole message,
+// a leading - negates a word or key, double quotes keep spaces in a value
+func Parse(input string) (Query, error) {
+	q := Query{Is: map[string]bool{}, Has: map[string]bool{}}
+
+	words, err := split(input)
+	if err != nil {
+		return q, err
+	}
+	if len(words) == 0 {
+		return q, fmt.Errorf("empty search")
+	}
+
+	for _, word := range words {
+		not := false
+		if len(word) > 1 && strings.HasPrefix(word, "-") {
+			not = true
+			word = word[1:]
+		}
+
+		key, value, hasKey := strings.Cut(word, ":")
+		key = strings.ToLower(key)
+
+		if !hasKey {
+			// bare states: unread, starred...
+			if s, ok := states[strings.ToLower(word)]; ok {
+				q.Is[s.name] = s.on != not
+				continue
+			}
+			q.Terms = append(q.Terms, Term{Field: "text", Value: word, Not: not})
+			continue
+		}
+
+		if value == "" {
+			return q, fmt.Errorf("%s: needs a value", key)
+		}
+
+		if field, ok := fields[key]; ok {
+			q.Terms = append(q.Terms, Term{Field: field, Value: value, Not: not})
+			continue
+		}
+
+		switch key {
+		case "is":
+			s, ok := states[strings.ToLower(value)]
+			if !ok {
+				return q, fmt.Errorf("unknown state is:%s", value)
+			}
+			q.Is[s.name] = s.on != not
+
+		case "has":
+			if v := strings.ToLower(value); v != "attachment" && v != "attachments" {
+				return q, fmt.Errorf("unknown has:%s, only has:attachment is supported", value)
+			}
+			q.Has["attachment"] = !not
+
+		case "since", "after", "before", "on":
+			if not {
+				return q, fmt.Errorf("%s: can't be negated", key)
+			}
+			day, err := time.ParseInLocation(DateLayout, value, time.Local)
+			if err != nil {
+				return q, fmt.Errorf("%s:%s is not a YYYY-MM-DD date", key, value)
+			}
+			switch key {
+			case "since", "after":
+				q.Since = day
+			case "before":
+				q.Before = day
+			default:
+				q.On = day
+			}
+
+		case "larger", "smaller":
+			if not {
+				return q, fmt.Errorf("%s: can't be negated", key)
+			}
+			size, err := parseSize(value)
+			if err != nil {
+				return q, err
+			}
+			if key == "larger" {
+				q.Larger = size
+			} else {
+				q.Smaller = size
+			}
+
+		case "in":
+			if not {
+				return q, fmt.Errorf("in: can't be negated")
+			}
+			if strings.EqualFold(value, "all") {
+				q.AllFolders = true
+			} else {
+				q.Folder = value
+			}
+
+		default:
+			return q, fmt.Errorf("unknown search key %s:", key)
+		}
+	}
+
+	return q, nil
+}
+
+// split cuts input at spaces outside double quotes, the quotes are dropped
+func split(input string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	quoted, started := false, false
+
+	for _, r := range input {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			started = true
+		case unicode.IsSpace(r) && !quoted:
+			if started {
+				words = append(words, word.String())
+				word.Reset()
+				started = false
+			}
+		default:
+			word.WriteRune(r)
+			started = true
+		}
+	}
+
+	if quoted {
+		return nil, fmt.Errorf("missing closing quote")
+	}
+	if started {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// parseSize reads sizes like 500, 20k or 5M
+func parseSize(value string) (uint32, error) {
+	multiplier := uint64(1)
+	number := strings.ToLower(value)
+	switch {
+	case strings.HasSuffix(number, "k"):
+		multiplier, number = 1<<10, strings.TrimSuffix(number, "k")
+	case strings.HasSuffix(number, "m"):
+		multiplier, number = 1<<20, strings.TrimSuffix(number, "m")
+	}
+
+	n, err := strconv.ParseUint(number, 10, 32)
+	if err != nil || n*multiplier > 1<<32-1 {
+		return 0, fmt.Errorf("%s is not a size like 500, 20k or 5M", value)
+	}
+	return uint32(n * multiplier), nil
+}
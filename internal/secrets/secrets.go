@@ -0,0 +1,156 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// prefix marks an encrypted value, the version lets the scheme change later without guessing
+const prefix = "enc:v1:"
+
+// argon2id parameters (RFC 9106 second recommendation)
+const (
+	argonTime    = 3
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+	keyLen       = 32
+	saltLen      = 16
+)
+
+// checkText is encrypted with the key when the vault is created, decrypting it proves a passphrase is right
+const checkText = "mailcat"
+
+var (
+	ErrLocked        = errors.New("secrets are locked, no passphrase given")
+	ErrBadPassphrase = errors.New("wrong passphrase")
+)
+
+var (
+	mu  sync.RWMutex
+	gcm cipher.AEAD
+)
+
+// Create derives a key for a new passphrase and unlocks with it.
+// salt and check have to be stored, Unlock needs both on the next start
+func Create(passphrase string) (salt []byte, check string, err error) {
+	salt = make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, "", fmt.Errorf("failed to generate salt: %v", err)
+	}
+
+	if err := setKey(passphrase, salt); err != nil {
+		return nil, "", err
+	}
+
+	check, err = Encrypt(checkText)
+	if err != nil {
+		return nil, "", err
+	}
+	return salt, check, nil
+}
+
+// Unlock derives the key from passphrase and salt, it fails when check doesn't decrypt
+func Unlock(passphrase string, salt []byte, check string) error {
+	if err := setKey(passphrase, salt); err != nil {
+		return err
+	}
+
+	if text, err := Decrypt(check); err != nil || text != checkText {
+		Lock()
+		return ErrBadPassphrase
+	}
+	return nil
+}
+
+// Lock forgets the key
+func Lock() {
+	mu.Lock()
+	gcm = nil
+	mu.Unlock()
+}
+
+// Unlocked reports whether a key is loaded
+func Unlocked() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return gcm != nil
+}
+
+// IsEncrypted reports whether s came out of Encrypt
+func IsEncrypted(s string) bool {
+	return strings.HasPrefix(s, prefix)
+}
+
+// Encrypt seals plain with AES-256-GCM, the result is "enc:v1:" + base64(nonce | ciphertext)
+func Encrypt(plain string) (string, error) {
+	mu.RLock()
+	aead := gcm
+	mu.RUnlock()
+	if aead == nil {
+		return "", ErrLocked
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %v", err)
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plain), nil)
+	return prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value from Encrypt. anything without the prefix is returned as is,
+// those are rows written before encryption existed
+func Decrypt(s string) (string, error) {
+	if !IsEncrypted(s) {
+		return s, nil
+	}
+
+	mu.RLock()
+	aead := gcm
+	mu.RUnlock()
+	if aead == nil {
+		return "", ErrLocked
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(s, prefix))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt: %v", err)
+	}
+	return string(plain), nil
+}
+
+func setKey(passphrase string, salt []byte) error {
+	if passphrase == "" {
+		return errors.New("passphrase must not be empty")
+	}
+
+	key := argon2.IDKey([]byte(passphrase), salt, argonTime, argonMemory, argonThreads, keyLen)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	gcm = aead
+	mu.Unlock()
+	return nil
+}
@@ -0,0 +1,115 @@
+package smtp
+
+import (
+	"errors"
+	"fmt"
+	"net/smtp"
+	"strings"
+
+	"github.com/emersion/go-sasl"
+)
+
+// loginAuth implements the non-standard but widespread AUTH LOGIN mechanism
+type loginAuth struct {
+	host     string
+	username string
+	password string
+}
+
+// LoginAuth returns an smtp.Auth for AUTH LOGIN.
+// like smtp.PlainAuth it refuses to send the password over an unencrypted connection to a remote host
+func LoginAuth(username, password, host string) smtp.Auth {
+	return &loginAuth{host: host, username: username, password: password}
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:", "user name", "username":
+		return []byte(a.username), nil
+	case "password:", "password":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected LOGIN challenge %q", fromServer)
+	}
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
+
+// advertises turns the AUTH extension parameter into a lookup for a single mechanism
+func advertises(mechanisms string) func(mech string) bool {
+	supported := strings.Fields(strings.ToUpper(mechanisms))
+	return func(mech string) bool {
+		for _, m := range supported {
+			if m == mech {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// pickAuth chooses PLAIN or LOGIN from what the server advertises in its AUTH extension
+func pickAuth(mechanisms, username, password, host string) (smtp.Auth, error) {
+	has := advertises(mechanisms)
+
+	switch {
+	case has("PLAIN"):
+		return smtp.PlainAuth("", username, password, host), nil
+	case has("LOGIN"):
+		return LoginAuth(username, password, host), nil
+	default:
+		return nil, fmt.Errorf("no supported AUTH mechanism in %q", mechanisms)
+	}
+}
+
+// saslAuth adapts a go-sasl client (used for OAUTHBEARER/XOAUTH2) to smtp.Auth.
+// bearer tokens get the same protection as passwords: no plain text connections to remote hosts
+type saslAuth struct {
+	client sasl.Client
+	host   string
+}
+
+func (a *saslAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return a.client.Start()
+}
+
+func (a *saslAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	return a.client.Next(fromServer)
+}
+
+// plaintextAllowed lets an auth run over an unencrypted connection, the mechanisms above refuse that on their own.
+// only used when the account explicitly allows plain text auth
+type plaintextAllowed struct {
+	smtp.Auth
+}
+
+func (a plaintextAllowed) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	info := *server
+	info.TLS = true
+	return a.Auth.Start(&info)
+}
@@ -0,0 +1,209 @@
+package smtp
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+
+	"github.com/vky5/mailcat/internal/credentials"
+	"github.com/vky5/mailcat/internal/db/models"
+	"github.com/vky5/mailcat/internal/oauth"
+	"github.com/vky5/mailcat/internal/tlsutil"
+)
+
+const dialTimeout = 30 * time.Second
+
+// ErrUnreachable wraps errors from connecting to the server, as opposed to the server refusing the message
+var ErrUnreachable = errors.New("SMTP server unreachable")
+
+// Retryable reports whether sending may work later: the server couldn't be reached,
+// the connection broke, or it answered with a temporary 4xx code
+func Retryable(err error) bool {
+	if errors.Is(err, ErrUnreachable) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return protoErr.Code >= 400 && protoErr.Code < 500
+	}
+
+	return false
+}
+
+// Send submits msg through the account's SMTP server
+func Send(acc models.Account, msg *Message) error {
+	rcpts, err := msg.Recipients()
+	if err != nil {
+		return err
+	}
+
+	raw, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	from := acc.Email
+	return SendRaw(acc, from, rcpts, raw)
+}
+
+// SendRaw submits an already rendered message, used when it has to be sent exactly as built
+func SendRaw(acc models.Account, from string, rcpts []string, raw []byte) error {
+	c, err := Dial(acc)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := c.Mail(from); err != nil {
+		return fmt.Errorf("MAIL FROM rejected: %w", err)
+	}
+	for _, rcpt := range rcpts {
+		if err := c.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("RCPT TO %s rejected: %w", rcpt, err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("DATA rejected: %w", err)
+	}
+	if _, err := w.Write(raw); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("message rejected: %w", err)
+	}
+
+	if err := c.Quit(); err != nil {
+		log.Println("SMTP QUIT failed:", err)
+	}
+	return nil
+}
+
+// Dial connects to the account's SMTP server, sets up the configured security and authenticates
+func Dial(acc models.Account) (*smtp.Client, error) {
+	if acc.SMTPHost == "" {
+		return nil, fmt.Errorf("no SMTP server configured for %s", acc.Email)
+	}
+
+	security := acc.SMTPSecurity
+	if security == "" {
+		security = models.SecuritySTARTTLS
+	}
+
+	port := acc.SMTPPort
+	if port == "" {
+		port = DefaultPort(security)
+	}
+
+	address := net.JoinHostPort(acc.SMTPHost, port)
+	tlsConfig, err := tlsutil.Config(acc, acc.SMTPHost)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn net.Conn
+	if security == models.SecurityTLS {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: dialTimeout}, "tcp", address, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", address, dialTimeout)
+	}
+	if err != nil {
+		// a bad certificate won't fix itself, so it isn't reported as unreachable
+		var verifyErr *tlsutil.VerifyError
+		if errors.As(tlsutil.Explain(acc.SMTPHost, err), &verifyErr) {
+			return nil, verifyErr
+		}
+		return nil, fmt.Errorf("%w: failed to connect to %s: %v", ErrUnreachable, address, err)
+	}
+
+	c, err := smtp.NewClient(conn, acc.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w: SMTP handshake with %s failed: %v", ErrUnreachable, address, err)
+	}
+
+	encrypted := security == models.SecurityTLS
+	if security == models.SecuritySTARTTLS || security == models.SecuritySTARTTLSOptional {
+		ok, _ := c.Extension("STARTTLS")
+		switch {
+		case ok:
+			if err := c.StartTLS(tlsConfig); err != nil {
+				c.Close()
+				return nil, fmt.Errorf("STARTTLS with %s failed: %w", address, tlsutil.Explain(acc.SMTPHost, err))
+			}
+			encrypted = true
+		case security == models.SecuritySTARTTLS:
+			c.Close()
+			return nil, fmt.Errorf("%s does not support STARTTLS", address)
+		default:
+			log.Println("No STARTTLS on", address, "- staying unencrypted")
+		}
+	}
+
+	// servers that don't advertise AUTH (local relays) take mail without it
+	if ok, mechanisms := c.Extension("AUTH"); ok {
+		password, err := credentials.Lookup(acc, acc.SMTPHost)
+		var auth smtp.Auth
+		if err == nil {
+			if credentials.UsesOAuth(acc) {
+				auth, err = oauthAuth(mechanisms, acc, password, port)
+			} else {
+				auth, err = pickAuth(mechanisms, acc.Email, password, acc.SMTPHost)
+			}
+		}
+		if err == nil && !encrypted {
+			if !acc.AllowPlaintextAuth {
+				err = fmt.Errorf("refusing to send credentials over an unencrypted connection (allow it with !plaintext)")
+			} else {
+				auth = plaintextAllowed{auth}
+			}
+		}
+		if err == nil {
+			err = c.Auth(auth)
+			if err != nil && credentials.UsesOAuth(acc) {
+				oauth.Invalidate(acc.ID)
+			}
+		}
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("SMTP login to %s failed: %w", address, err)
+		}
+	}
+
+	return c, nil
+}
+
+// DefaultPort is the usual submission port of a security mode
+func DefaultPort(security string) string {
+	switch security {
+	case models.SecurityTLS:
+		return "465"
+	case models.SecurityNone:
+		return "25"
+	default:
+		return "587"
+	}
+}
+
+// oauthAuth builds the OAUTHBEARER/XOAUTH2 auth for an access token
+func oauthAuth(mechanisms string, acc models.Account, token, port string) (smtp.Auth, error) {
+	p, _ := strconv.Atoi(port)
+	client, err := oauth.NewClient(advertises(mechanisms), acc.Email, token, acc.SMTPHost, p)
+	if err != nil {
+		return nil, err
+	}
+	return &saslAuth{client: client, host: acc.SMTPHost}, nil
+}
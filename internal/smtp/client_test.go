@@ -0,0 +1,298 @@
+package smtp
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vky5/mailcat/internal/db/models"
+)
+
+// fakeSMTP is a minimal SMTP server on a local listener. it offers AUTH only once the
+// connection is encrypted and records what the client did
+type fakeSMTP struct {
+	implicitTLS bool // TLS from the first byte, like port 465
+	starttls    bool // advertise STARTTLS
+	tlsConfig   *tls.Config
+
+	mu       sync.Mutex
+	upgraded bool     // STARTTLS ran
+	authTLS  bool     // the connection was encrypted when AUTH came
+	auth     string   // decoded AUTH PLAIN response
+	rcpts    []string // RCPT TO addresses
+	data     string
+}
+
+// start listens on 127.0.0.1 and returns the port
+func (f *fakeSMTP) start(t *testing.T) string {
+	t.Helper()
+
+	var ln net.Listener
+	var err error
+	if f.implicitTLS {
+		ln, err = tls.Listen("tcp", "127.0.0.1:0", f.tlsConfig)
+	} else {
+		ln, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	return port
+}
+
+func (f *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+
+	encrypted := f.implicitTLS
+	r := bufio.NewReader(conn)
+	reply := func(lines ...string) {
+		for _, l := range lines {
+			conn.Write([]byte(l + "\r\n"))
+		}
+	}
+
+	reply("220 fake ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch verb {
+		case "EHLO":
+			lines := []string{"250-fake"}
+			if f.starttls && !encrypted {
+				lines = append(lines, "250-STARTTLS")
+			}
+			if encrypted {
+				lines = append(lines, "250-AUTH PLAIN LOGIN")
+			}
+			reply(append(lines, "250 8BITMIME")...)
+
+		case "STARTTLS":
+			reply("220 go ahead")
+			tlsConn := tls.Server(conn, f.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, r, encrypted = tlsConn, bufio.NewReader(tlsConn), true
+			f.mu.Lock()
+			f.upgraded = true
+			f.mu.Unlock()
+
+		case "AUTH":
+			fields := strings.Fields(line)
+			if len(fields) != 3 || fields[1] != "PLAIN" {
+				reply("504 only PLAIN with an initial response")
+				continue
+			}
+			plain, _ := base64.StdEncoding.DecodeString(fields[2])
+			f.mu.Lock()
+			f.auth, f.authTLS = string(plain), encrypted
+			f.mu.Unlock()
+			reply("235 ok")
+
+		case "MAIL":
+			reply("250 ok")
+
+		case "RCPT":
+			f.mu.Lock()
+			f.rcpts = append(f.rcpts, strings.Trim(strings.TrimPrefix(line, "RCPT TO:"), "<>"))
+			f.mu.Unlock()
+			reply("250 ok")
+
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			f.mu.Lock()
+			f.data = data.String()
+			f.mu.Unlock()
+			reply("250 queued")
+
+		case "QUIT":
+			reply("221 bye")
+			return
+
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+// testCert makes a self-signed certificate for 127.0.0.1, the PEM is written to a file for TLSCAFile
+func testCert(t *testing.T) (*tls.Config, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, caFile
+}
+
+func testAccount(security, port, caFile string) models.Account {
+	return models.Account{
+		Email:        "me@example.org",
+		Password:     "secret",
+		SMTPHost:     "127.0.0.1",
+		SMTPPort:     port,
+		SMTPSecurity: security,
+		TLSCAFile:    caFile,
+	}
+}
+
+// sendTest sends a small message through acc and checks what the fake server got
+func sendTest(t *testing.T, f *fakeSMTP, acc models.Account) {
+	t.Helper()
+
+	msg := &Message{
+		From:    "me@example.org",
+		To:      []string{"alice@example.org"},
+		Bcc:     []string{"hidden@example.org"},
+		Subject: "hello",
+		Body:    "hi alice",
+	}
+	if err := Send(acc, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.authTLS {
+		t.Errorf("AUTH sent before the connection was encrypted")
+	}
+	if f.auth != "\x00me@example.org\x00secret" {
+		t.Errorf("AUTH PLAIN = %q", f.auth)
+	}
+	if strings.Join(f.rcpts, " ") != "alice@example.org hidden@example.org" {
+		t.Errorf("RCPT TO = %v", f.rcpts)
+	}
+	if !strings.Contains(f.data, "Subject: hello") || strings.Contains(f.data, "hidden@example.org") {
+		t.Errorf("unexpected DATA:\n%s", f.data)
+	}
+}
+
+func TestDialImplicitTLS(t *testing.T) {
+	tlsConfig, caFile := testCert(t)
+	f := &fakeSMTP{implicitTLS: true, tlsConfig: tlsConfig}
+	port := f.start(t)
+
+	sendTest(t, f, testAccount(models.SecurityTLS, port, caFile))
+}
+
+func TestDialSTARTTLS(t *testing.T) {
+	tlsConfig, caFile := testCert(t)
+	f := &fakeSMTP{starttls: true, tlsConfig: tlsConfig}
+	port := f.start(t)
+
+	sendTest(t, f, testAccount(models.SecuritySTARTTLS, port, caFile))
+	if !f.upgraded {
+		t.Errorf("STARTTLS was not used")
+	}
+}
+
+func TestDialSTARTTLSRequired(t *testing.T) {
+	tlsConfig, caFile := testCert(t)
+	f := &fakeSMTP{tlsConfig: tlsConfig}
+	port := f.start(t)
+
+	c, err := Dial(testAccount(models.SecuritySTARTTLS, port, caFile))
+	if err == nil {
+		c.Close()
+		t.Fatal("Dial went on without STARTTLS")
+	}
+	if !strings.Contains(err.Error(), "does not support STARTTLS") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestDialUntrustedCertificate(t *testing.T) {
+	tlsConfig, _ := testCert(t)
+	f := &fakeSMTP{implicitTLS: true, tlsConfig: tlsConfig}
+	port := f.start(t)
+
+	c, err := Dial(testAccount(models.SecurityTLS, port, ""))
+	if err == nil {
+		c.Close()
+		t.Fatal("Dial accepted a self-signed certificate")
+	}
+	if Retryable(err) {
+		t.Errorf("a bad certificate is reported as retryable: %v", err)
+	}
+}
+
+func TestDialUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	ln.Close()
+
+	_, err = Dial(testAccount(models.SecuritySTARTTLS, port, ""))
+	if err == nil || !Retryable(err) {
+		t.Errorf("Dial to a closed port = %v, want a retryable error", err)
+	}
+}
@@ -0,0 +1,145 @@
+package smtp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Message is an outgoing message, turned into RFC 5322 text by Bytes
+type Message struct {
+	From       string
+	To         []string
+	Cc         []string
+	Bcc        []string // only used for the envelope, never written to the headers
+	Subject    string
+	Body       string // plain text, UTF-8
+	Date       time.Time
+	MessageID  string // generated when empty
+	InReplyTo  string
+	References string
+}
+
+// Recipients returns the bare addresses of everyone the message goes to, Bcc included
+func (m *Message) Recipients() ([]string, error) {
+	var rcpts []string
+
+	for _, list := range [][]string{m.To, m.Cc, m.Bcc} {
+		addrs, err := parseAddresses(list)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range addrs {
+			rcpts = append(rcpts, a.Address)
+		}
+	}
+
+	if len(rcpts) == 0 {
+		return nil, fmt.Errorf("message has no recipients")
+	}
+	return rcpts, nil
+}
+
+// Bytes renders the message as RFC 5322 text with MIME headers.
+// non ASCII headers are RFC 2047 encoded, the body goes out as quoted-printable UTF-8
+func (m *Message) Bytes() ([]byte, error) {
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid From address %q: %v", m.From, err)
+	}
+
+	to, err := parseAddresses(m.To)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := parseAddresses(m.Cc)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Date.IsZero() {
+		m.Date = time.Now()
+	}
+	if m.MessageID == "" {
+		m.MessageID = NewMessageID(from.Address)
+	}
+
+	var b bytes.Buffer
+	writeHeader := func(name, value string) {
+		if value != "" {
+			b.WriteString(name + ": " + value + "\r\n")
+		}
+	}
+
+	writeHeader("From", from.String())
+	writeHeader("To", formatAddresses(to))
+	writeHeader("Cc", formatAddresses(cc))
+	writeHeader("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	writeHeader("Date", m.Date.Format(time.RFC1123Z))
+	writeHeader("Message-ID", m.MessageID)
+	writeHeader("In-Reply-To", m.InReplyTo)
+	writeHeader("References", m.References)
+	writeHeader("MIME-Version", "1.0")
+	writeHeader("Content-Type", "text/plain; charset=utf-8")
+	writeHeader("Content-Transfer-Encoding", "quoted-printable")
+	b.WriteString("\r\n")
+
+	// quoted-printable wants CRLF line breaks in the input to keep them as hard breaks
+	body := strings.ReplaceAll(m.Body, "\r\n", "\n")
+	body = strings.ReplaceAll(body, "\n", "\r\n")
+
+	qp := quotedprintable.NewWriter(&b)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	b.WriteString("\r\n")
+
+	return b.Bytes(), nil
+}
+
+func parseAddresses(list []string) ([]*mail.Address, error) {
+	var out []*mail.Address
+	for _, s := range list {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		addrs, err := mail.ParseAddressList(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q: %v", s, err)
+		}
+		out = append(out, addrs...)
+	}
+	return out, nil
+}
+
+// formatAddresses joins addresses, String() takes care of encoding display names
+func formatAddresses(addrs []*mail.Address) string {
+	parts := make([]string, len(addrs))
+	for i, a := range addrs {
+		parts[i] = a.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// NewMessageID returns a random <id@domain> using the domain of the sender
+func NewMessageID(from string) string {
+	domain := "mailcat.local"
+	if at := strings.LastIndex(from, "@"); at >= 0 && at < len(from)-1 {
+		domain = from[at+1:]
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("<%d@%s>", time.Now().UnixNano(), domain)
+	}
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(buf), domain)
+}
@@ -0,0 +1,140 @@
+package smtp
+
+import (
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"testing"
+)
+
+func TestMessageBytes(t *testing.T) {
+	m := &Message{
+		From:    "Zoë <zoe@example.org>",
+		To:      []string{"alice@example.org, Bob <bob@example.org>"},
+		Cc:      []string{"carol@example.org"},
+		Bcc:     []string{"secret@example.org"},
+		Subject: "Café au lait ☕",
+		Body:    "first line\nsecond line with ünïcode and a = sign\n",
+	}
+
+	raw, err := m.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "secret@example.org") || strings.Contains(strings.ToLower(string(raw)), "bcc:") {
+		t.Fatalf("Bcc leaked into the message:\n%s", raw)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for header, want := range map[string]string{
+		"MIME-Version":              "1.0",
+		"Content-Type":              "text/plain; charset=utf-8",
+		"Content-Transfer-Encoding": "quoted-printable",
+	} {
+		if got := msg.Header.Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	if msg.Header.Get("Message-ID") == "" || msg.Header.Get("Date") == "" {
+		t.Errorf("Message-ID or Date missing")
+	}
+
+	// RFC 2047: the raw header is ASCII, decoded it's the original subject
+	subject := msg.Header.Get("Subject")
+	if !strings.HasPrefix(subject, "=?utf-8?q?") {
+		t.Errorf("Subject %q is not RFC 2047 encoded", subject)
+	}
+	decoded, err := new(mime.WordDecoder).DecodeHeader(subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded != m.Subject {
+		t.Errorf("decoded Subject = %q, want %q", decoded, m.Subject)
+	}
+
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil || from.Name != "Zoë" || from.Address != "zoe@example.org" {
+		t.Errorf("From = %q, parsed %v (%v)", msg.Header.Get("From"), from, err)
+	}
+	to, err := msg.Header.AddressList("To")
+	if err != nil || len(to) != 2 {
+		t.Errorf("To = %q, want 2 addresses (%v)", msg.Header.Get("To"), err)
+	}
+
+	body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "first line\r\nsecond line with ünïcode and a = sign\r\n"
+	if strings.TrimRight(string(body), "\r\n") != strings.TrimRight(want, "\r\n") {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+
+	rcpts, err := m.Recipients()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(rcpts, " ") != "alice@example.org bob@example.org carol@example.org secret@example.org" {
+		t.Errorf("Recipients = %v, Bcc must be in the envelope", rcpts)
+	}
+}
+
+func TestPickAuth(t *testing.T) {
+	server := &smtp.ServerInfo{Name: "mail.example.org", TLS: true}
+
+	for _, tt := range []struct {
+		mechanisms string
+		want       string // mechanism the auth starts, empty for an error
+	}{
+		{"PLAIN LOGIN", "PLAIN"},
+		{"LOGIN PLAIN CRAM-MD5", "PLAIN"},
+		{"LOGIN", "LOGIN"},
+		{"login xoauth2", "LOGIN"},
+		{"CRAM-MD5", ""},
+		{"", ""},
+	} {
+		auth, err := pickAuth(tt.mechanisms, "me@example.org", "secret", "mail.example.org")
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("pickAuth(%q) picked an auth, want an error", tt.mechanisms)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("pickAuth(%q): %v", tt.mechanisms, err)
+			continue
+		}
+
+		mech, _, err := auth.Start(server)
+		if err != nil {
+			t.Errorf("pickAuth(%q).Start: %v", tt.mechanisms, err)
+			continue
+		}
+		if mech != tt.want {
+			t.Errorf("pickAuth(%q) = %s, want %s", tt.mechanisms, mech, tt.want)
+		}
+	}
+}
+
+func TestLoginAuthRefusesPlaintext(t *testing.T) {
+	auth := LoginAuth("me@example.org", "secret", "mail.example.org")
+	if _, _, err := auth.Start(&smtp.ServerInfo{Name: "mail.example.org"}); err == nil {
+		t.Errorf("LOGIN started over an unencrypted connection to a remote host")
+	}
+
+	next, err := auth.Next([]byte("Username:"), true)
+	if err != nil || string(next) != "me@example.org" {
+		t.Errorf("username challenge answered %q (%v)", next, err)
+	}
+	next, err = auth.Next([]byte("Password:"), true)
+	if err != nil || string(next) != "secret" {
+		t.Errorf("password challenge answered %q (%v)", next, err)
+	}
+}
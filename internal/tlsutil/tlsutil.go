@@ -0,0 +1,169 @@
+package tlsutil
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/vky5/mailcat/internal/db/models"
+)
+
+// Config builds the tls.Config used for both the IMAP and the SMTP server of an account:
+// - TLSCAFile: PEM bundle trusted on top of the system roots (internal CAs)
+// - TLSPinSHA256: SHA-256 of the server certificate, when set it replaces CA and hostname checks
+// - TLSClientCert/TLSClientKey: PEM client certificate for servers asking for one
+// - TLSMinVersion: "1.0" to "1.3", 1.2 when empty
+func Config(acc models.Account, serverName string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName: serverName, // needed for TLS verification
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if acc.TLSMinVersion != "" {
+		v, err := parseVersion(acc.TLSMinVersion)
+		if err != nil {
+			return nil, err
+		}
+		cfg.MinVersion = v
+	}
+
+	if acc.TLSCAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(acc.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %v", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", acc.TLSCAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if acc.TLSClientCert != "" || acc.TLSClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(acc.TLSClientCert, acc.TLSClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if acc.TLSPinSHA256 != "" {
+		pin, err := parsePin(acc.TLSPinSHA256)
+		if err != nil {
+			return nil, err
+		}
+
+		// the pin is the trust decision, self-signed certificates are the usual reason to set one
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return &VerifyError{Host: serverName, Reason: "server sent no certificate"}
+			}
+			got := sha256.Sum256(cs.PeerCertificates[0].Raw)
+			if string(got[:]) != string(pin) {
+				return &VerifyError{
+					Host:   serverName,
+					Reason: "certificate SHA-256 " + Fingerprint(cs.PeerCertificates[0]) + " does not match the pin",
+				}
+			}
+			return nil
+		}
+	}
+
+	return cfg, nil
+}
+
+// Fingerprint is the SHA-256 of a certificate in hex, the format accepted as a pin
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// parsePin accepts hex (colons allowed, as printed by openssl) or "sha256/<base64>"
+func parsePin(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+
+	var pin []byte
+	var err error
+	if b64, ok := strings.CutPrefix(s, "sha256/"); ok {
+		pin, err = base64.StdEncoding.DecodeString(b64)
+	} else {
+		pin, err = hex.DecodeString(strings.ReplaceAll(s, ":", ""))
+	}
+	if err != nil || len(pin) != sha256.Size {
+		return nil, fmt.Errorf("invalid certificate pin %q, want a SHA-256 in hex or sha256/<base64>", s)
+	}
+	return pin, nil
+}
+
+func parseVersion(s string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s)), "tls") {
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unknown TLS version %q, use 1.0 to 1.3", s)
+	}
+}
+
+// VerifyError is a certificate problem, worth showing to the user as is
+type VerifyError struct {
+	Host   string
+	Reason string
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("TLS verification of %s failed: %s", e.Host, e.Reason)
+}
+
+// Explain turns certificate errors into a VerifyError with a readable reason, other errors pass through.
+// for an unknown CA the fingerprint is included so it can be pinned or checked out of band
+func Explain(host string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var verifyErr *VerifyError
+	if errors.As(err, &verifyErr) {
+		return verifyErr
+	}
+
+	var unknownCA x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+
+	switch {
+	case errors.As(err, &unknownCA):
+		reason := "certificate signed by an unknown authority (set a CA bundle or pin it)"
+		if unknownCA.Cert != nil {
+			reason += ", SHA-256 " + Fingerprint(unknownCA.Cert)
+		}
+		return &VerifyError{Host: host, Reason: reason}
+	case errors.As(err, &hostname):
+		return &VerifyError{Host: host, Reason: "certificate is not valid for this host name: " + hostname.Error()}
+	case errors.As(err, &invalid):
+		return &VerifyError{Host: host, Reason: invalid.Error()}
+	case errors.As(err, &certErr):
+		return &VerifyError{Host: host, Reason: certErr.Err.Error()}
+	case errors.As(err, &recordErr):
+		return &VerifyError{Host: host, Reason: "server did not answer with TLS, wrong port or security mode?"}
+	}
+
+	return err
+}
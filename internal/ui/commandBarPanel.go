@@ -13,6 +13,7 @@ type CommandBar struct {
 	box      *tview.Flex
 	input    *tview.InputField
 	hintText *tview.TextView
+	status   *tview.TextView // background status (e.g. the outbox), right of the hint, messages don't replace it
 	registry map[string]commands.Command
 	active   commands.Command
 	app      *tview.Application
@@ -46,10 +47,19 @@ func NewCommandBar(app *tview.Application) *CommandBar {
 	cb.hintText.SetTextAlign(tview.AlignLeft)
 	cb.hintText.SetBackgroundColor(tcell.NewRGBColor(18, 30, 40)) // dark
 
+	cb.status = tview.NewTextView()
+	cb.status.SetDynamicColors(true)
+	cb.status.SetTextAlign(tview.AlignRight)
+	cb.status.SetBackgroundColor(tcell.NewRGBColor(18, 30, 40))
+
+	hintRow := tview.NewFlex().
+		AddItem(cb.hintText, 0, 2, false).
+		AddItem(cb.status, 0, 1, false)
+
 	// Layout (keep dark background)
 	cb.box = tview.NewFlex().
 		SetDirection(tview.FlexRow).
-		AddItem(cb.hintText, 1, 0, false).
+		AddItem(hintRow, 1, 0, false).
 		AddItem(cb.input, 1, 0, true)
 
 	cb.box.SetBackgroundColor(tcell.NewRGBColor(18, 30, 40))
@@ -67,6 +77,11 @@ func (cb *CommandBar) ShowPlaceholder(msg string) {
 	cb.input.SetPlaceholder(msg)
 }
 
+// SetStatus sets the background status at the right end of the hint line, "" clears it
+func (cb *CommandBar) SetStatus(status string) {
+	cb.status.SetText("[#D0D0D0]" + tview.Escape(status))
+}
+
 func (cb *CommandBar) ShowMessage(msg string) {
 	cb.hintText.SetText(msg)
 }
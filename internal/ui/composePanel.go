@@ -0,0 +1,238 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/vky5/mailcat/internal/compose"
+	"github.com/vky5/mailcat/internal/logger"
+)
+
+// ComposePanel is the full screen form used to write new mail, replies and forwards
+type ComposePanel struct {
+	form    *composeForm
+	app     *tview.Application
+	draft   compose.Draft
+	sending bool // a send is running, further Ctrl-S are ignored until SetSending(false)
+	onSend  func(d compose.Draft)
+	onClose func(d compose.Draft, changed bool)
+}
+
+// composeForm is a tview.Form whose body grows with the screen
+type composeForm struct {
+	*tview.Form
+	body *tview.TextArea
+}
+
+// Draw gives the body every row the header fields and buttons don't use
+func (f *composeForm) Draw(screen tcell.Screen) {
+	if f.body != nil {
+		_, _, _, height := f.GetInnerRect()
+		// 4 header fields with a blank row after each, blank row + buttons below the body
+		rows := height - 10
+		if rows < 3 {
+			rows = 3
+		}
+		f.body.SetSize(rows, 0)
+	}
+	f.Form.Draw(screen)
+}
+
+const composeTitle = " ✏️  Compose (Ctrl-S send, Ctrl-E $EDITOR, Esc close) "
+
+// NewComposePanel creates the compose form.
+// onSend gets the finished draft, onClose is called when the user leaves without sending
+func NewComposePanel(app *tview.Application, onSend func(d compose.Draft), onClose func(d compose.Draft, changed bool)) *ComposePanel {
+	cp := &ComposePanel{
+		form:    &composeForm{Form: tview.NewForm()},
+		app:     app,
+		onSend:  onSend,
+		onClose: onClose,
+	}
+
+	cp.form.SetBorder(true).
+		SetTitle(composeTitle).
+		SetBackgroundColor(tcell.NewRGBColor(18, 30, 40)).SetBorderAttributes(tcell.AttrDim)
+
+	cp.form.SetLabelColor(tcell.NewRGBColor(135, 206, 235)).
+		SetFieldBackgroundColor(tcell.NewRGBColor(22, 35, 48)).
+		SetFieldTextColor(tcell.NewRGBColor(224, 224, 224)).
+		SetButtonBackgroundColor(tcell.NewRGBColor(0, 100, 150))
+
+	cp.form.SetCancelFunc(cp.close)
+
+	cp.form.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyCtrlS:
+			cp.send()
+			return nil
+		case tcell.KeyCtrlE:
+			cp.editExternally()
+			return nil
+		}
+		return event
+	})
+
+	cp.form.SetFocusFunc(func() {
+		cp.form.SetBorderColor(tcell.NewRGBColor(0, 191, 255))
+	})
+	cp.form.SetBlurFunc(func() {
+		cp.form.SetBorderColor(tcell.ColorNone).SetBorderAttributes(tcell.AttrDim)
+	})
+
+	return cp
+}
+
+// SetDraft fills the form from a draft
+func (cp *ComposePanel) SetDraft(d compose.Draft) {
+	cp.draft = d
+	cp.form.Clear(true)
+
+	// the cursor starts above the quoted text, not after it
+	body := tview.NewTextArea().
+		SetLabel("Body").
+		SetSize(16, 0)
+	body.SetText(d.Body, false)
+	cp.form.body = body
+
+	cp.form.AddInputField("To", d.To, 0, nil, nil).
+		AddInputField("Cc", d.Cc, 0, nil, nil).
+		AddInputField("Bcc", d.Bcc, 0, nil, nil).
+		AddInputField("Subject", d.Subject, 0, nil, nil).
+		AddFormItem(body).
+		AddButton("Send", cp.send).
+		AddButton("Edit in $EDITOR", cp.editExternally).
+		AddButton("Close", cp.close)
+
+	// replies already know the recipient, forwards and new mail still need one
+	if d.To == "" {
+		cp.form.SetFocus(0)
+	} else {
+		cp.form.SetFocus(cp.form.GetFormItemIndex("Body"))
+	}
+}
+
+// Draft returns the draft with whatever was typed into the form
+func (cp *ComposePanel) Draft() compose.Draft {
+	d := cp.draft
+	d.To = cp.inputText("To")
+	d.Cc = cp.inputText("Cc")
+	d.Bcc = cp.inputText("Bcc")
+	d.Subject = cp.inputText("Subject")
+	if cp.form.body != nil {
+		d.Body = cp.form.body.GetText()
+	}
+	return d
+}
+
+// MarkSaved records that the current content is stored, so closing doesn't ask again
+func (cp *ComposePanel) MarkSaved(d compose.Draft) {
+	cp.draft = d
+}
+
+func (cp *ComposePanel) inputText(label string) string {
+	if field, ok := cp.form.GetFormItemByLabel(label).(*tview.InputField); ok {
+		return field.GetText()
+	}
+	return ""
+}
+
+// SetSending is called with false once the send started by onSend has finished, either way
+func (cp *ComposePanel) SetSending(sending bool) {
+	cp.sending = sending
+	if sending {
+		cp.form.SetTitle(" ✏️  Compose - sending... ")
+	} else {
+		cp.form.SetTitle(composeTitle)
+	}
+}
+
+func (cp *ComposePanel) send() {
+	if cp.sending {
+		return
+	}
+
+	d := cp.Draft()
+	if strings.TrimSpace(d.To+d.Cc+d.Bcc) == "" {
+		cp.form.SetFocus(0)
+		cp.app.SetFocus(cp.form)
+		return
+	}
+	if cp.onSend != nil {
+		cp.SetSending(true)
+		cp.onSend(d)
+	}
+}
+
+func (cp *ComposePanel) close() {
+	if cp.onClose != nil {
+		d := cp.Draft()
+		cp.onClose(d, d != cp.draft)
+	}
+}
+
+// editExternally hands the body to $EDITOR and reads it back once the editor exits
+func (cp *ComposePanel) editExternally() {
+	if cp.form.body == nil {
+		return
+	}
+
+	text, err := editInEditor(cp.app, cp.form.body.GetText())
+	if err != nil {
+		logger.Error("External editor failed:", err)
+		return
+	}
+
+	cp.form.body.SetText(text, false)
+	cp.form.SetFocus(cp.form.GetFormItemIndex("Body"))
+	cp.app.SetFocus(cp.form)
+}
+
+// editInEditor writes text to a temp file, suspends the TUI while $EDITOR runs on it and returns the result
+func editInEditor(app *tview.Application, text string) (string, error) {
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+
+	file, err := os.CreateTemp("", "mailcat-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %v", err)
+	}
+	path := file.Name()
+	defer os.Remove(path)
+
+	_, err = file.WriteString(text)
+	file.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to write temp file: %v", err)
+	}
+
+	var runErr error
+	app.Suspend(func() {
+		cmd := exec.Command(editor[0], append(editor[1:], path)...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		runErr = cmd.Run()
+	})
+	if runErr != nil {
+		return "", fmt.Errorf("%s exited with: %v", editor[0], runErr)
+	}
+
+	edited, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read back temp file: %v", err)
+	}
+
+	return string(edited), nil
+}
+
+// Primitive returns the tview primitive
+func (cp *ComposePanel) Primitive() tview.Primitive {
+	return cp.form
+}
@@ -0,0 +1,249 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/emersion/go-imap/client"
+	"github.com/rivo/tview"
+	"github.com/vky5/mailcat/internal/compose"
+	"github.com/vky5/mailcat/internal/db"
+	"github.com/vky5/mailcat/internal/db/models"
+	"github.com/vky5/mailcat/internal/imap"
+	"github.com/vky5/mailcat/internal/logger"
+)
+
+// emailActions runs the per message actions triggered from the list and open panels.
+// changes show up in the UI and cache right away and are rolled back if the server rejects them
+type emailActions struct {
+	app     *tview.Application
+	list    *EmailListPanel
+	open    *EmailOpenPanel
+	folders *FolderPanel
+	counts  *unreadCounts
+	cmdBar  *CommandBar
+
+	openCompose func(d compose.Draft)                         // shows the compose panel
+	pickFolder  func(title string, done func(t FolderTarget)) // shows the folder picker popup
+}
+
+// flagStore is one of the imap.SetSeen / imap.SetStarred style helpers
+type flagStore func(conn *client.Client, mailbox string, uid uint32, on bool) error
+
+// emailFlag is a flag the user can toggle, with the Email field and cache column behind it
+type emailFlag struct {
+	column string
+	field  func(e *models.Email) *bool
+	store  flagStore
+	unread bool // setting it makes the message read, the folder's unread count follows
+}
+
+var (
+	seenFlag    = emailFlag{"read", func(e *models.Email) *bool { return &e.Read }, imap.SetSeen, true}
+	starredFlag = emailFlag{"starred", func(e *models.Email) *bool { return &e.Starred }, imap.SetStarred, false}
+)
+
+// unreadDelta is how the folder's unread count changes when flag goes from the state in email to on
+func (flag emailFlag) unreadDelta(email models.Email, on bool) int {
+	if !flag.unread || *flag.field(&email) == on {
+		return 0
+	}
+	if on {
+		return -1
+	}
+	return 1
+}
+
+// ToggleSeen flips the read state of an email
+func (ea *emailActions) ToggleSeen(email models.Email) {
+	ea.setFlag(email, seenFlag, !email.Read)
+}
+
+// MarkSeen marks an opened email as read, unless it already is
+func (ea *emailActions) MarkSeen(email models.Email) {
+	if !email.Read {
+		ea.ToggleSeen(email)
+	}
+}
+
+// ToggleStarred flips the starred (\Flagged) state of an email
+func (ea *emailActions) ToggleStarred(email models.Email) {
+	ea.setFlag(email, starredFlag, !email.Starred)
+}
+
+// Reply opens the compose panel with a quoted reply to email
+func (ea *emailActions) Reply(email models.Email) {
+	ea.openCompose(compose.Reply(email))
+}
+
+// Forward opens the compose panel with email forwarded inline
+func (ea *emailActions) Forward(email models.Email) {
+	ea.openCompose(compose.Forward(email))
+}
+
+// EditDraft reopens a draft from the server's Drafts mailbox in the compose panel
+func (ea *emailActions) EditDraft(email models.Email) {
+	if !email.Draft {
+		ea.cmdBar.ShowMessage("Only drafts can be edited")
+		return
+	}
+	ea.openCompose(compose.FromEmail(email))
+}
+
+// Delete moves an email to Trash (or expunges it) and drops it from the UI once the server is done
+func (ea *emailActions) Delete(email models.Email) {
+	ea.cmdBar.ShowMessage("Deleting: " + email.Subject)
+
+	go func() {
+		err := ea.withConnection(email.AccountID, func(conn *client.Client) error {
+			return imap.DeleteMessage(conn, email.Mailbox, email.UID)
+		})
+		if err != nil {
+			logger.Error("Delete failed for", email.Subject, ":", err)
+			ea.app.QueueUpdateDraw(func() {
+				ea.cmdBar.ShowMessage("[red]Delete failed: " + err.Error())
+			})
+			return
+		}
+
+		if err := db.DeleteEmailsByUID(email.AccountID, email.Mailbox, []uint32{email.UID}); err != nil {
+			logger.Error("Failed to drop deleted email from cache:", err)
+		}
+
+		ea.counts.Refresh(email.AccountID, email.Mailbox)
+		ea.app.QueueUpdateDraw(func() {
+			ea.list.RemoveEmail(email.ID)
+			if cur := ea.open.GetEmail(); cur != nil && cur.ID == email.ID {
+				ea.open.Clear()
+			}
+			ea.folders.SetFolderEmails(email.AccountID, email.Mailbox, ea.list.Emails())
+			ea.cmdBar.ShowMessage("Deleted: " + email.Subject)
+		})
+	}()
+}
+
+// Move moves an email to a folder picked in a popup, which may belong to another account
+func (ea *emailActions) Move(email models.Email) {
+	ea.transfer(email, true)
+}
+
+// Copy copies an email to a folder picked in a popup, which may belong to another account
+func (ea *emailActions) Copy(email models.Email) {
+	ea.transfer(email, false)
+}
+
+func (ea *emailActions) transfer(email models.Email, move bool) {
+	title, verb, past := " Copy to ", "Copying", "Copied"
+	if move {
+		title, verb, past = " Move to ", "Moving", "Moved"
+	}
+
+	ea.pickFolder(title, func(t FolderTarget) {
+		ea.cmdBar.ShowMessage(verb + ": " + email.Subject + " → " + t.Folder)
+
+		go func() {
+			var src, dst models.Account
+			err := db.DB.First(&src, email.AccountID).Error
+			if err == nil {
+				err = db.DB.First(&dst, t.AccountID).Error
+			}
+			if err == nil {
+				err = imap.Transfer(src, email.Mailbox, []uint32{email.UID}, dst, t.Folder, move)
+			}
+			if err != nil {
+				logger.Error(verb, email.Subject, "failed:", err)
+				ea.app.QueueUpdateDraw(func() {
+					ea.cmdBar.ShowMessage("[red]" + verb + " failed: " + err.Error())
+				})
+				return
+			}
+
+			ea.counts.Refresh(t.AccountID, t.Folder)
+			if move {
+				ea.counts.Refresh(email.AccountID, email.Mailbox)
+			}
+
+			ea.app.QueueUpdateDraw(func() {
+				if move {
+					ea.list.RemoveEmail(email.ID)
+					if cur := ea.open.GetEmail(); cur != nil && cur.ID == email.ID {
+						ea.open.Clear()
+					}
+					ea.folders.SetFolderEmails(email.AccountID, email.Mailbox, ea.list.Emails())
+				}
+				ea.cmdBar.ShowMessage(fmt.Sprintf("%s: %s → %s (%s)", past, email.Subject, t.Folder, t.Account))
+			})
+		}()
+	})
+}
+
+// setFlag shows the flag change immediately, then writes it to the server in the background.
+// a rejection only reverts this flag, other changes made meanwhile stay
+func (ea *emailActions) setFlag(email models.Email, flag emailFlag, on bool) {
+	// the server's unread count only comes with the next STATUS, until then it's adjusted here
+	delta := flag.unreadDelta(email, on)
+
+	updated := email
+	*flag.field(&updated) = on
+	ea.folders.AdjustUnseen(updated.AccountID, updated.Mailbox, delta)
+	ea.show(updated)
+	if err := db.UpdateEmailFlag(updated.AccountID, updated.Mailbox, updated.UID, flag.column, on); err != nil {
+		logger.Error("Failed to update cached flags:", err)
+	}
+
+	go func() {
+		err := ea.withConnection(updated.AccountID, func(conn *client.Client) error {
+			return flag.store(conn, updated.Mailbox, updated.UID, on)
+		})
+		if err == nil {
+			ea.counts.Refresh(updated.AccountID, updated.Mailbox)
+			return
+		}
+
+		logger.Error("Flag change rejected for", updated.Subject, ":", err)
+		if err := db.UpdateEmailFlag(updated.AccountID, updated.Mailbox, updated.UID, flag.column, !on); err != nil {
+			logger.Error("Failed to roll back cached flags:", err)
+		}
+
+		ea.app.QueueUpdateDraw(func() {
+			current := ea.current(updated)
+			if *flag.field(&current) == on {
+				*flag.field(&current) = !on
+				ea.folders.AdjustUnseen(current.AccountID, current.Mailbox, -delta)
+				ea.show(current)
+			}
+			ea.cmdBar.ShowMessage("[red]Server rejected the change: " + err.Error())
+		})
+	}()
+}
+
+// current returns email as it is shown right now, it may have changed since an action started
+func (ea *emailActions) current(email models.Email) models.Email {
+	for _, e := range ea.list.Emails() {
+		if e.ID == email.ID {
+			return e
+		}
+	}
+	if cur := ea.open.GetEmail(); cur != nil && cur.ID == email.ID {
+		return *cur
+	}
+	return email
+}
+
+// withConnection runs fn on the pooled IMAP connection of an account
+func (ea *emailActions) withConnection(accountID uint, fn func(conn *client.Client) error) error {
+	var acc models.Account
+	if err := db.DB.First(&acc, accountID).Error; err != nil {
+		return err
+	}
+
+	return imap.Do(acc, fn)
+}
+
+// show puts a changed email on screen everywhere it is displayed
+func (ea *emailActions) show(email models.Email) {
+	ea.list.UpdateEmail(email)
+	if cur := ea.open.GetEmail(); cur != nil && cur.ID == email.ID {
+		ea.open.UpdateEmail(email)
+	}
+	ea.folders.SetFolderEmails(email.AccountID, email.Mailbox, ea.list.Emails())
+}
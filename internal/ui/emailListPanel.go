@@ -6,6 +6,7 @@ import (
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
+	"github.com/vky5/mailcat/internal/db"
 	"github.com/vky5/mailcat/internal/db/models"
 	"github.com/vky5/mailcat/internal/logger"
 )
@@ -16,8 +17,12 @@ type EmailListPanel struct {
 	emails   []models.Email
 	onSelect func(email models.Email)
 	maxWidth int
+	snippets map[uint]string // matched text by email ID, shown instead of the preview for local search results
 }
 
+// title of the list when it shows a folder
+const emailListTitle = " 📬 Emails "
+
 // NewEmailListPanel creates a styled table for email list.
 func NewEmailListPanel(onSelect func(email models.Email)) *EmailListPanel {
 	logger.Info("NewEmailListPanel: Creating new email list panel")
@@ -29,7 +34,7 @@ func NewEmailListPanel(onSelect func(email models.Email)) *EmailListPanel {
 
 	// Table styling with gradient-like background
 	el.table.SetBorder(true).
-		SetTitle(" 📬 Emails ").
+		SetTitle(emailListTitle).
 		// SetBorderColor(tcell.NewRGBColor(0, 191, 255)).
 		SetBackgroundColor(tcell.NewRGBColor(18, 30, 40)).SetBorderAttributes(tcell.AttrDim)
 
@@ -110,6 +115,7 @@ func getPreviewText(body string, maxLen int) string {
 func (el *EmailListPanel) SetEmails(emails []models.Email) {
 	logger.Info("SetEmails: Called with", len(emails), "emails")
 	el.emails = emails
+	el.snippets = nil
 	logger.Info("SetEmails: Calling render()")
 	el.render()
 
@@ -129,6 +135,46 @@ func (el *EmailListPanel) SetEmails(emails []models.Email) {
 	logger.Info("SetEmails: Completed successfully")
 }
 
+// SetSearchResults lists emails like SetEmails, with the matched text of each in place of its preview
+func (el *EmailListPanel) SetSearchResults(emails []models.Email, snippets map[uint]string) {
+	el.SetEmails(emails)
+	el.snippets = snippets
+	el.render()
+}
+
+// snippetText formats a search snippet for a cell, the words between db.HighlightStart and
+// db.HighlightEnd stand out. at most maxLen characters are shown
+func snippetText(snippet, color string, maxLen int) string {
+	var b strings.Builder
+	rest := strings.Join(strings.Fields(snippet), " ")
+	left := maxLen
+	highlighted := false
+
+	for rest != "" && left > 0 {
+		marker := db.HighlightStart
+		if highlighted {
+			marker = db.HighlightEnd
+		}
+		part, after, found := strings.Cut(rest, marker)
+
+		part = truncateString(part, left)
+		left -= len([]rune(part))
+		b.WriteString(tview.Escape(part))
+		if !found {
+			break
+		}
+
+		if highlighted {
+			b.WriteString("[" + color + "::-]")
+		} else {
+			b.WriteString("[#FFD700::b]")
+		}
+		highlighted = !highlighted
+		rest = after
+	}
+	return b.String()
+}
+
 // render displays emails with rich formatting
 func (el *EmailListPanel) render() {
 	logger.Info("render: Starting render with", len(el.emails), "emails")
@@ -161,21 +207,36 @@ func (el *EmailListPanel) render() {
 		fromColor := "#87CEEB"
 		previewColor := "#778899"
 		dateColor := "#00CED1"
-		style := ""
+		attrs := ""
 		if !e.Read {
 			envelope = "📧"
 			subjectColor = "#FFD700"
 			fromColor = "#00BFFF"
 			previewColor = "#B0C4DE"
 			dateColor = "#32CD32"
-			style = "::b"
+			attrs += "b"
+		}
+
+		// Deleted but not yet expunged messages are struck through
+		if e.Deleted {
+			attrs += "s"
 		}
 
-		// Priority/importance indicator
-		priorityIcon := ""
-		if strings.Contains(strings.ToLower(e.Subject), "urgent") ||
-			strings.Contains(strings.ToLower(e.Subject), "important") {
-			priorityIcon = " [#FF4500]⚠️[-]"
+		style := ""
+		if attrs != "" {
+			style = "::" + attrs
+		}
+
+		// State indicators from the server flags
+		stateIcons := ""
+		if e.Starred {
+			stateIcons += " [#FFD700]⭐[-]"
+		}
+		if e.Answered {
+			stateIcons += " [#32CD32]↩[-]"
+		}
+		if e.Draft {
+			stateIcons += " [#B0C4DE]📝[-]"
 		}
 
 		// Attachment icon
@@ -190,7 +251,7 @@ func (el *EmailListPanel) render() {
 			style,
 			envelope,
 			truncateString(e.Subject, el.maxWidth-20),
-			priorityIcon,
+			stateIcons,
 			attachmentInfo,
 		)
 		dateText := fmt.Sprintf("[%s]%s[-]", dateColor, e.Date.Format("Jan 2"))
@@ -221,6 +282,9 @@ func (el *EmailListPanel) render() {
 
 		// Row 3: Preview
 		previewText := fmt.Sprintf("   [%s]%s[-]", previewColor, getPreviewText(e.Body, el.maxWidth-3))
+		if snippet := el.snippets[e.ID]; snippet != "" {
+			previewText = fmt.Sprintf("   [%s]🔎 %s[-:-:-]", previewColor, snippetText(snippet, previewColor, el.maxWidth-6))
+		}
 		previewCell := tview.NewTableCell(previewText).
 			SetAlign(tview.AlignLeft).
 			SetBackgroundColor(bgColor).
@@ -252,6 +316,116 @@ func (el *EmailListPanel) render() {
 	logger.Info("render: Render completed")
 }
 
+// Selected returns the email under the cursor, nil when the list is empty
+func (el *EmailListPanel) Selected() *models.Email {
+	row, _ := el.table.GetSelection()
+	idx := (row - 1) / 4
+	if row < 1 || idx >= len(el.emails) {
+		return nil
+	}
+	return &el.emails[idx]
+}
+
+// UpdateEmail replaces the email with the same ID and re-renders, keeping the cursor where it is
+func (el *EmailListPanel) UpdateEmail(email models.Email) {
+	for i := range el.emails {
+		if el.emails[i].ID == email.ID {
+			el.emails[i] = email
+			el.render()
+			return
+		}
+	}
+}
+
+// RemoveEmail drops an email from the list, the cursor stays on the same row when possible
+func (el *EmailListPanel) RemoveEmail(id uint) {
+	for i := range el.emails {
+		if el.emails[i].ID == id {
+			// fresh backing array, the old slice may still be referenced by a Folder
+			el.emails = append(el.emails[:i:i], el.emails[i+1:]...)
+			break
+		}
+	}
+
+	row, _ := el.table.GetSelection()
+	el.render()
+
+	switch {
+	case len(el.emails) == 0:
+		el.table.Select(2, 0)
+	case row > len(el.emails)*4:
+		el.table.Select(len(el.emails)*4-3, 0)
+	}
+}
+
+// PrependEmails puts newly arrived emails (newest first) on top of the list.
+// the cursor stays on the email it was on, ones already listed are skipped
+func (el *EmailListPanel) PrependEmails(emails []models.Email) {
+	listed := make(map[uint]bool, len(el.emails))
+	for _, e := range el.emails {
+		listed[e.ID] = true
+	}
+
+	var fresh []models.Email
+	for _, e := range emails {
+		if !listed[e.ID] {
+			fresh = append(fresh, e)
+		}
+	}
+	if len(fresh) == 0 {
+		return
+	}
+
+	wasEmpty := len(el.emails) == 0
+	row, _ := el.table.GetSelection()
+
+	// fresh backing array, the old slice may still be referenced by a Folder
+	el.emails = append(fresh, el.emails...)
+	el.render()
+
+	if wasEmpty || row < 1 {
+		el.table.Select(1, 0)
+	} else {
+		el.table.Select(row+len(fresh)*4, 0)
+	}
+}
+
+// RemoveUIDs drops the emails with these UIDs, used when the server expunged them
+func (el *EmailListPanel) RemoveUIDs(uids []uint32) {
+	gone := make(map[uint32]bool, len(uids))
+	for _, uid := range uids {
+		gone[uid] = true
+	}
+
+	var ids []uint
+	for _, e := range el.emails {
+		if gone[e.UID] {
+			ids = append(ids, e.ID)
+		}
+	}
+	for _, id := range ids {
+		el.RemoveEmail(id)
+	}
+}
+
+// Emails returns the emails currently listed
+func (el *EmailListPanel) Emails() []models.Email {
+	return el.emails
+}
+
+// SetTitle names what the list shows, like search results. empty goes back to the folder title
+func (el *EmailListPanel) SetTitle(title string) {
+	if title == "" {
+		title = emailListTitle
+	}
+	el.table.SetTitle(title)
+}
+
+// SetInputCapture allows setting custom key handlers
+func (el *EmailListPanel) SetInputCapture(capture func(event *tcell.EventKey) *tcell.EventKey) {
+	el.table.SetInputCapture(capture)
+}
+
 // Primitive returns the tview primitive
 func (el *EmailListPanel) Primitive() tview.Primitive {
 	return el.table
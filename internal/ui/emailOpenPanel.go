@@ -68,6 +68,14 @@ func (ep *EmailOpenPanel) SetEmail(email models.Email) {
 	ep.render()
 }
 
+// UpdateEmail re-renders the panel for a changed copy of the shown email, keeping the scroll position
+func (ep *EmailOpenPanel) UpdateEmail(email models.Email) {
+	row, col := ep.textView.GetScrollOffset()
+	ep.email = &email
+	ep.render()
+	ep.textView.ScrollTo(row, col)
+}
+
 // render displays the email content with rich formatting
 func (ep *EmailOpenPanel) render() {
 	if ep.email == nil {
@@ -87,6 +95,11 @@ func (ep *EmailOpenPanel) render() {
 	}
 	content.WriteString(fmt.Sprintf("[%s::b]📨 %s[-:-:-]\n\n", subjectColor, ep.email.Subject))
 
+	// Flags
+	if ep.email.Starred {
+		content.WriteString("[#FFD700]⭐ Starred[-]\n\n")
+	}
+
 	// From field
 	content.WriteString(fmt.Sprintf("[#87CEEB::b]From:[-:-:-] [#B0C4DE]%s[-]\n", ep.email.From))
 
@@ -133,6 +146,10 @@ func (ep *EmailOpenPanel) render() {
 
 	// Footer hint
 	content.WriteString("\n[#778899]Press [#32CD32]r[-] to reply  •  [#32CD32]f[-] to forward  •  [#32CD32]d[-] to delete[-]\n")
+	content.WriteString("[#778899]      [#32CD32]u[-] to mark read/unread  •  [#32CD32]s[-] to star[-]\n")
+	if ep.email.Draft {
+		content.WriteString("[#778899]      [#32CD32]e[-] to edit this draft[-]\n")
+	}
 
 	ep.textView.SetText(content.String())
 	ep.textView.ScrollToBeginning()
@@ -0,0 +1,60 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// FolderTarget is a folder messages can be moved or copied to
+type FolderTarget struct {
+	AccountID uint
+	Account   string // email of the account
+	Folder    string
+	icon      string
+}
+
+// NewFolderPicker shows targets in a centered popup. enter calls onPick, esc calls onCancel.
+// it returns the popup and the list to focus
+func NewFolderPicker(title string, targets []FolderTarget, onPick func(t FolderTarget), onCancel func()) (tview.Primitive, tview.Primitive) {
+	list := tview.NewList()
+	list.SetBorder(true).SetTitle(title)
+	list.SetBorderColor(tcell.NewRGBColor(0, 191, 255))
+	list.SetBackgroundColor(tcell.NewRGBColor(18, 30, 40))
+	list.ShowSecondaryText(false)
+	list.SetHighlightFullLine(true)
+	list.SetMainTextColor(tcell.NewRGBColor(180, 220, 255))
+	list.SetSelectedBackgroundColor(tcell.NewRGBColor(0, 100, 150))
+	list.SetSelectedTextColor(tcell.ColorWhite)
+
+	lastAccount := uint(0)
+	for _, t := range targets {
+		// account headers only group the folders below them
+		if t.AccountID != lastAccount {
+			list.AddItem(fmt.Sprintf("[::b][#00BFFF]📧 %s[-:-:-]", tview.Escape(t.Account)), "", 0, nil)
+			lastAccount = t.AccountID
+		}
+
+		target := t // copy for closure
+		list.AddItem(fmt.Sprintf("   %s %s", t.icon, tview.Escape(t.Folder)), "", 0, func() {
+			onPick(target)
+		})
+	}
+	if len(targets) > 0 {
+		list.SetCurrentItem(1) // first folder, not the header
+	}
+
+	list.SetDoneFunc(onCancel)
+
+	// centered like a modal
+	popup := tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(list, 0, 3, true).
+			AddItem(nil, 0, 1, false), 0, 2, true).
+		AddItem(nil, 0, 1, false)
+
+	return popup, list
+}
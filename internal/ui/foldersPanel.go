@@ -2,15 +2,27 @@ package ui
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 	"github.com/vky5/mailcat/internal/db/models"
+	"github.com/vky5/mailcat/internal/imap"
 )
 
 type Folder struct {
 	Name   string // e.g Inbox, sent, trash
 	Emails []models.Email
+
+	Delimiter  string // hierarchy separator from LIST, "" when the server has none
+	SpecialUse string // \Sent, \Trash... from SPECIAL-USE, "" for ordinary folders
+	Noselect   bool   // only holds other folders, can't be opened
+
+	// server side counts from STATUS, Counted is false until the first answer
+	Counted  bool
+	Messages int
+	Unseen   int
+	Recent   int
 }
 
 // Account is emails
@@ -19,6 +31,9 @@ type Account struct {
 	Email    string
 	Folders  []Folder
 	Expanded bool // shows whether we show the folders or not
+	State    imap.ConnState
+
+	Collapsed map[string]bool // folders whose subfolders are hidden
 }
 
 // struct that connects data to UI
@@ -27,10 +42,15 @@ type FolderPanel struct {
 	accounts     []*Account                   // our data model
 	onSelect     func(account, folder string) // callback when a folder is selected
 	onAddAccount func()                       // callback when add account is selected
+	toggles      map[int]func()               // list index -> expand/collapse, for the space key
 }
 
-// get unread emails count
+// get unread emails count, the loaded emails stand in until the server reported
 func (f *Folder) UnreadCount() int {
+	if f.Counted {
+		return f.Unseen
+	}
+
 	count := 0
 	for _, e := range f.Emails {
 		if !e.Read {
@@ -40,34 +60,119 @@ func (f *Folder) UnreadCount() int {
 	return count
 }
 
-// getFolderIcon returns appropriate emoji for folder type
-func getFolderIcon(folderName string) string {
-	switch folderName {
-	case "Inbox":
+// getFolderIcon returns appropriate emoji for folder type,
+// going by the SPECIAL-USE attribute and by the usual names for servers without one
+func getFolderIcon(f Folder) string {
+	switch f.SpecialUse {
+	case `\Sent`:
+		return "📤"
+	case `\Drafts`:
+		return "📝"
+	case `\Trash`:
+		return "🗑️"
+	case `\Junk`:
+		return "🚫"
+	case `\Archive`, `\All`:
+		return "📦"
+	case `\Flagged`, `\Important`:
+		return "⭐"
+	}
+
+	if f.Noselect {
+		return "🗂️"
+	}
+
+	switch strings.ToLower(folderLabel(f.Name, f.Delimiter)) {
+	case "inbox":
 		return "📥"
-	case "Sent":
+	case "sent", "sent mail", "sent items", "sent messages":
 		return "📤"
-	case "Drafts":
+	case "drafts":
 		return "📝"
-	case "Trash":
+	case "trash", "deleted items", "deleted messages", "bin":
 		return "🗑️"
-	case "Spam":
+	case "spam", "junk":
 		return "🚫"
-	case "Archive":
+	case "archive", "all mail":
 		return "📦"
-	case "Important":
+	case "important", "starred":
 		return "⭐"
 	default:
 		return "📁"
 	}
 }
 
+// folderLabel is the last part of a folder's name, "Sent Mail" for "[Gmail]/Sent Mail"
+func folderLabel(name, delimiter string) string {
+	if delimiter == "" {
+		return name
+	}
+	parts := strings.Split(name, delimiter)
+	return parts[len(parts)-1]
+}
+
+// folderNode is a folder in the hierarchy, folder is nil for parents the server didn't list
+type folderNode struct {
+	path     string
+	label    string
+	folder   *Folder
+	children []*folderNode
+}
+
+// folderTree nests the folders by their delimiter, keeping the order the server listed them in
+func folderTree(folders []Folder) []*folderNode {
+	var roots []*folderNode
+	nodes := make(map[string]*folderNode)
+
+	for i := range folders {
+		f := &folders[i]
+		parts := []string{f.Name}
+		if f.Delimiter != "" {
+			parts = strings.Split(f.Name, f.Delimiter)
+		}
+
+		var parent *folderNode
+		for j, part := range parts {
+			path := strings.Join(parts[:j+1], f.Delimiter)
+			n, ok := nodes[path]
+			if !ok {
+				n = &folderNode{path: path, label: part}
+				nodes[path] = n
+				if parent == nil {
+					roots = append(roots, n)
+				} else {
+					parent.children = append(parent.children, n)
+				}
+			}
+			parent = n
+		}
+		parent.folder = f
+	}
+
+	return roots
+}
+
+// unread counts the unread mail of a node, with its subfolders when they're hidden
+func (n *folderNode) unread(withChildren bool) int {
+	count := 0
+	if n.folder != nil && !n.folder.Noselect {
+		count = n.folder.UnreadCount()
+	}
+	if withChildren {
+		for _, c := range n.children {
+			count += c.unread(true)
+		}
+	}
+	return count
+}
+
 // describing the basic layout of the panel returning the folder panel
 func NewFolderPanel(onSelect func(account string, folder string), onAddAccount func()) *FolderPanel {
 	fp := &FolderPanel{
 		list:         tview.NewList(),
 		onSelect:     onSelect,
 		onAddAccount: onAddAccount,
+		toggles:      make(map[int]func()),
 	}
 
 	fp.list.SetBorder(true).SetTitle(" 📂 Accounts ")
@@ -87,12 +192,24 @@ func NewFolderPanel(onSelect func(account string, folder string), onAddAccount f
 		fp.list.SetBorderColor(tcell.ColorNone).SetBorderAttributes(tcell.AttrDim) // remove highlight on blur
 	})
 
+	// space folds accounts and folders with subfolders, enter on a folder opens it
+	fp.list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyRune && event.Rune() == ' ' {
+			if toggle, ok := fp.toggles[fp.list.GetCurrentItem()]; ok {
+				toggle()
+				return nil
+			}
+		}
+		return event
+	})
+
 	return fp
 }
 
 // helper func to add account to the panel
-func (fp *FolderPanel) AddAccount(email string, folders []Folder) {
+func (fp *FolderPanel) AddAccount(id uint, email string, folders []Folder) {
 	account := &Account{
+		ID:       id,
 		Email:    email,
 		Folders:  folders,
 		Expanded: false,
@@ -106,6 +223,18 @@ func (fp *FolderPanel) AddAccount(email string, folders []Folder) {
 func (fp *FolderPanel) UpdateAccount(email string, folders []Folder) {
 	for _, acc := range fp.accounts {
 		if acc.Email == email {
+			// counts of folders that are still there stay until the next refresh
+			old := make(map[string]Folder, len(acc.Folders))
+			for _, f := range acc.Folders {
+				old[f.Name] = f
+			}
+			for i := range folders {
+				if f, ok := old[folders[i].Name]; ok && f.Counted && !folders[i].Counted {
+					folders[i].Counted = true
+					folders[i].Messages, folders[i].Unseen, folders[i].Recent = f.Messages, f.Unseen, f.Recent
+				}
+			}
+
 			acc.Folders = folders
 			fp.render()
 			return
@@ -113,9 +242,126 @@ func (fp *FolderPanel) UpdateAccount(email string, folders []Folder) {
 	}
 }
 
+// SetAccountState shows the IMAP connection state next to an account
+func (fp *FolderPanel) SetAccountState(accountID uint, state imap.ConnState) {
+	for _, acc := range fp.accounts {
+		if acc.ID == accountID {
+			acc.State = state
+			fp.render()
+			return
+		}
+	}
+}
+
+// stateBadge is the marker after the account name, nothing until the first connect
+func stateBadge(state imap.ConnState) string {
+	switch state {
+	case imap.StateConnected:
+		return " [#32CD32]●[-]"
+	case imap.StateReconnecting:
+		return " [#FFA500]◌ reconnecting[-]"
+	case imap.StateOffline:
+		return " [#FF6347]○ offline[-]"
+	default:
+		return ""
+	}
+}
+
+// SetFolderEmails stores the loaded emails of a folder so its unread badge is up to date
+func (fp *FolderPanel) SetFolderEmails(accountID uint, folderName string, emails []models.Email) {
+	for _, acc := range fp.accounts {
+		if acc.ID != accountID {
+			continue
+		}
+		for i := range acc.Folders {
+			if acc.Folders[i].Name == folderName {
+				acc.Folders[i].Emails = emails
+				fp.render()
+				return
+			}
+		}
+	}
+}
+
+// SetFolderCounts stores the STATUS counts of an account's folders, folders missing from counts keep theirs
+func (fp *FolderPanel) SetFolderCounts(accountID uint, counts map[string]imap.FolderStatus) {
+	for _, acc := range fp.accounts {
+		if acc.ID != accountID {
+			continue
+		}
+		for i := range acc.Folders {
+			c, ok := counts[acc.Folders[i].Name]
+			if !ok {
+				continue
+			}
+			acc.Folders[i].Counted = true
+			acc.Folders[i].Messages = int(c.Messages)
+			acc.Folders[i].Unseen = int(c.Unseen)
+			acc.Folders[i].Recent = int(c.Recent)
+		}
+		fp.render()
+		return
+	}
+}
+
+// virtualFolder reports whether a folder only shows mail kept in other folders too (Gmail's All Mail,
+// Starred, Important), counting it would count the same unread mail twice
+func virtualFolder(f Folder) bool {
+	switch f.SpecialUse {
+	case `\All`, `\Flagged`, `\Important`:
+		return true
+	}
+	return false
+}
+
+// AdjustUnseen moves a folder's server side unread count by delta, for changes made here
+// before the next STATUS confirms them. folders not counted yet derive theirs from the loaded emails
+func (fp *FolderPanel) AdjustUnseen(accountID uint, folderName string, delta int) {
+	if delta == 0 {
+		return
+	}
+	for _, acc := range fp.accounts {
+		if acc.ID != accountID {
+			continue
+		}
+		for i := range acc.Folders {
+			f := &acc.Folders[i]
+			if f.Name == folderName && f.Counted {
+				f.Unseen = max(f.Unseen+delta, 0)
+				fp.render()
+				return
+			}
+		}
+	}
+}
+
+// Targets returns every folder that can be opened, account by account
+func (fp *FolderPanel) Targets() []FolderTarget {
+	var targets []FolderTarget
+	for _, acc := range fp.accounts {
+		for _, f := range acc.Folders {
+			if f.Noselect {
+				continue
+			}
+			targets = append(targets, FolderTarget{
+				AccountID: acc.ID,
+				Account:   acc.Email,
+				Folder:    f.Name,
+				icon:      getFolderIcon(f),
+			})
+		}
+	}
+	return targets
+}
+
 // refresh the panel with new emails or updates
 func (fp *FolderPanel) render() {
+	// re-rendering shouldn't throw the cursor back to the top
+	current := fp.list.GetCurrentItem()
+	defer fp.list.SetCurrentItem(current)
+
 	fp.list.Clear()
+	fp.toggles = make(map[int]func())
 
 	// Add New Account with vibrant styling
 	fp.list.AddItem("[::b][#32CD32]✨ Add New Account[-:-:-]", "", 0, func() {
@@ -131,7 +377,9 @@ func (fp *FolderPanel) render() {
 		// Top-level account with email icon and better styling
 		totalUnread := 0
 		for _, f := range acc.Folders {
-			totalUnread += f.UnreadCount()
+			if !virtualFolder(f) {
+				totalUnread += f.UnreadCount()
+			}
 		}
 
 		expandIcon := "▶"
@@ -144,57 +392,126 @@ func (fp *FolderPanel) render() {
 			accText = fmt.Sprintf("[::b][#00BFFF]%s 📧 %s [#FFD700](%d)[-:-:-]", expandIcon, acc.Email, totalUnread)
 		}
 
-		fp.list.AddItem(accText, "", 0, func(a *Account) func() {
+		accText += stateBadge(acc.State)
+
+		toggle := func(a *Account) func() {
 			return func() {
 				a.Expanded = !a.Expanded
 				fp.render()
 			}
-		}(acc))
+		}(acc)
+		fp.list.AddItem(accText, "", 0, toggle)
+		fp.toggles[fp.list.GetItemCount()-1] = toggle
 
 		if acc.Expanded {
-			// Folder children with better icons and styling
-			for i, f := range acc.Folders {
-				line := "├──"
-				if i == len(acc.Folders)-1 {
-					line = "└──"
-				}
+			fp.renderFolders(acc, folderTree(acc.Folders), "  ")
+		}
+	}
+}
 
-				unread := f.UnreadCount()
-				folderIcon := getFolderIcon(f.Name)
+// renderFolders adds a level of the folder tree, indent carries the lines of the levels above
+func (fp *FolderPanel) renderFolders(acc *Account, nodes []*folderNode, indent string) {
+	for i, n := range nodes {
+		line, childIndent := "├──", indent+"│  "
+		if i == len(nodes)-1 {
+			line, childIndent = "└──", indent+"   "
+		}
 
-				// Base folder color
-				folderColor := "#B0B0B0" // gray for read
-				folderStyle := ""
+		collapsed := acc.Collapsed[n.path]
+		hasChildren := len(n.children) > 0
 
-				// Highlight if unread
-				if unread > 0 {
-					folderColor = "#FFD700" // gold for unread
-					folderStyle = "::b"
-				}
+		expander := ""
+		if hasChildren {
+			expander = "▾ "
+			if collapsed {
+				expander = "▸ "
+			}
+		}
 
-				// Format unread count
-				unreadText := ""
-				if unread > 0 {
-					unreadText = fmt.Sprintf(" [#32CD32::b](%d)[-:-:-]", unread)
-				} else {
-					unreadText = fmt.Sprintf(" [#778899](%d)[-]", unread)
-				}
+		label := tview.Escape(n.label) // "[Gmail]" would pass for a color tag
+		folder := Folder{Name: n.path, Noselect: true}
+		if n.folder != nil {
+			folder = *n.folder
+		}
 
-				folderText := fmt.Sprintf("  [#4682B4]%s[-] [%s%s]%s %s[-:-:-]%s",
-					line,
-					folderColor,
-					folderStyle,
-					folderIcon,
-					f.Name,
-					unreadText,
-				)
-
-				folder := f // copy for closure
-				accountEmail := acc.Email
-				fp.list.AddItem(folderText, "", 0, func() {
-					fp.onSelect(accountEmail, folder.Name)
-				})
+		var folderText string
+		if folder.Noselect {
+			// containers only hold other folders, no counts of their own
+			unreadText := ""
+			if unread := n.unread(collapsed); unread > 0 {
+				unreadText = fmt.Sprintf(" [#32CD32::b](%d)[-:-:-]", unread)
 			}
+			folderText = fmt.Sprintf("[#4682B4]%s%s[-] [#708090]%s%s %s[-]%s",
+				indent, line, expander, getFolderIcon(folder), label, unreadText)
+		} else {
+			unread := n.unread(collapsed)
+
+			// Base folder color
+			folderColor := "#B0B0B0" // gray for read
+			folderStyle := ""
+
+			// Highlight if unread
+			if unread > 0 {
+				folderColor = "#FFD700" // gold for unread
+				folderStyle = "::b"
+			}
+
+			// Format unread count, with the total once the server told us
+			total := ""
+			if folder.Counted {
+				total = fmt.Sprintf("/%d", folder.Messages)
+			}
+			unreadText := ""
+			if unread > 0 {
+				unreadText = fmt.Sprintf(" [#32CD32::b](%d%s)[-:-:-]", unread, total)
+			} else {
+				unreadText = fmt.Sprintf(" [#778899](%d%s)[-]", unread, total)
+			}
+			if folder.Recent > 0 {
+				unreadText += fmt.Sprintf(" [#FF69B4]+%d[-]", folder.Recent)
+			}
+
+			folderText = fmt.Sprintf("[#4682B4]%s%s[-] %s[%s%s]%s %s[-:-:-]%s",
+				indent,
+				line,
+				expander,
+				folderColor,
+				folderStyle,
+				getFolderIcon(folder),
+				label,
+				unreadText,
+			)
+		}
+
+		path := n.path
+		toggle := func() {
+			if acc.Collapsed == nil {
+				acc.Collapsed = make(map[string]bool)
+			}
+			acc.Collapsed[path] = !acc.Collapsed[path]
+			fp.render()
+		}
+
+		// containers aren't opened, enter folds them instead
+		var selected func()
+		switch {
+		case !folder.Noselect:
+			accountEmail := acc.Email
+			name := folder.Name
+			selected = func() {
+				fp.onSelect(accountEmail, name)
+			}
+		case hasChildren:
+			selected = toggle
+		}
+
+		fp.list.AddItem(folderText, "", 0, selected)
+		if hasChildren {
+			fp.toggles[fp.list.GetItemCount()-1] = toggle
+		}
+
+		if !collapsed {
+			fp.renderFolders(acc, n.children, childIndent)
 		}
 	}
 }
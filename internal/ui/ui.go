@@ -1,16 +1,28 @@
 package ui
 
 import (
+	"errors"
+	"fmt"
+
+	"github.com/emersion/go-imap/client"
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 	"github.com/vky5/mailcat/internal/commands"
+	"github.com/vky5/mailcat/internal/compose"
 	"github.com/vky5/mailcat/internal/db"
 	"github.com/vky5/mailcat/internal/db/models"
 	"github.com/vky5/mailcat/internal/imap"
 	"github.com/vky5/mailcat/internal/logger"
+	"github.com/vky5/mailcat/internal/outbox"
+	"github.com/vky5/mailcat/internal/search"
+	"github.com/vky5/mailcat/internal/tlsutil"
+	"github.com/vky5/mailcat/internal/watcher"
 	"strings"
 )
 
+// the most matches a search shows
+const searchLimit = 200
+
 // StartUI builds the overall layout and starts the TUI.
 func StartUI(_ []*Account) error {
 	logger.Info("Starting UI initialization...")
@@ -20,12 +32,19 @@ func StartUI(_ []*Account) error {
 	logger.Info("Creating email open panel...")
 	emailOpenPanel := NewEmailOpenPanel()
 
+	// message actions (flag toggles...) and the folder panel, wired up once every panel exists
+	var actions *emailActions
+	var fp *FolderPanel
+	var cmdBar *CommandBar
+	var counts *unreadCounts
+
 	// ===== Middle Panel =====
 	logger.Info("Creating email list panel...")
 	emailPanel := NewEmailListPanel(func(email models.Email) {
 		logger.Info("Email selected:", email.Subject)
 		emailOpenPanel.SetEmail(email)
 		app.SetFocus(emailOpenPanel.Primitive())
+		actions.MarkSeen(email)
 	})
 
 	// loader to show when fetching emails
@@ -34,6 +53,17 @@ func StartUI(_ []*Account) error {
 	// accounts kept in UI memory
 	accounts := []*Account{}
 
+	// bumped on every folder selection, only touched from the UI thread
+	var selection uint64
+
+	// the folder shown in the email list, live updates only go there. UI thread only as well
+	var openAccountID uint
+	var openFolder string
+	var searching bool // the list shows search results instead of the open folder
+
+	// stops following the open folder, the watcher only knows the configured ones otherwise
+	unfollow := func() {}
+
 	// ===== Folder Selection Callback =====
 	onSelect := func(accountEmail, folderName string) {
 		logger.Info("Folder selected - Account:", accountEmail, "Folder:", folderName)
@@ -53,6 +83,18 @@ func StartUI(_ []*Account) error {
 
 		logger.Info("Account found in UI memory, showing loader...")
 
+		// every selection gets a token so a slow fetch can't overwrite a folder opened after it
+		selection++
+		token := selection
+		openAccountID = acc.ID
+		openFolder = strings.Trim(strings.TrimSpace(folderName), `"`)
+		searching = false
+
+		// live updates for whatever folder is open, not just the watched ones
+		unfollow()
+		unfollow = watcher.Follow(acc.ID, openFolder)
+		emailPanel.SetTitle("")
+
 		// show loader immediately (we're already in UI thread context)
 		logger.Info("Setting loader...")
 		emailPanel.SetLoading(NewLoader("Fetching emails..."))
@@ -61,10 +103,16 @@ func StartUI(_ []*Account) error {
 		go func() {
 			logger.Info("Goroutine started for folder:", folderName)
 
+			// set to true once the cached copy is on screen, so errors don't wipe it
+			showingCache := false
+
 			// Helper to update UI with error
 			showError := func(msg string, err error) {
 				logger.Error(msg, err)
 				app.QueueUpdateDraw(func() {
+					if token != selection || showingCache {
+						return
+					}
 					logger.Info("QueueUpdateDraw: Clearing loading state due to error")
 					emailPanel.SetEmails([]models.Email{}) // Clear loading state
 					// Optionally show error message in the panel
@@ -80,36 +128,76 @@ func StartUI(_ []*Account) error {
 			}
 			logger.Info("Database account fetched successfully")
 
-			// IMAP connection with timeout context
-			logger.Info("Attempting IMAP connection...")
-			conn, err := imap.GetConnection(dbAcc)
-			if err != nil {
-				showError("IMAP reconnect failed:", err)
-				return
-			}
-			logger.Info("IMAP connection established successfully")
-
 			// clean mailbox name
 			clean := strings.TrimSpace(folderName)
 			clean = strings.Trim(clean, `"`)
 			logger.Info("Cleaned folder name:", clean)
 
-			logger.Info("Starting FetchEmails from:", clean)
-			emails, err := imap.FetchEmails(conn, clean, 50, 1)
+			// render whatever is cached first so browsing doesn't wait on the network
+			cached, err := db.GetEmails(dbAcc.ID, clean, 50)
+			if err != nil {
+				logger.Error("Failed reading cache for", clean, ":", err)
+			}
+			if len(cached) > 0 {
+				logger.Info("Showing", len(cached), "cached emails from", clean)
+				showingCache = true
+				app.QueueUpdateDraw(func() {
+					if token != selection {
+						return
+					}
+					emailPanel.SetEmails(cached)
+					emailOpenPanel.Clear()
+					app.SetFocus(emailPanel.Primitive())
+				})
+			}
+
+			// the sync waits for a free worker connection of the account
+			logger.Info("Attempting IMAP connection...")
+			var result *imap.SyncResult
+			connected := false
+			err = imap.Do(dbAcc, func(conn *client.Client) error {
+				connected = true
+				logger.Info("Starting SyncMailbox for:", clean)
+				var err error
+				result, err = imap.SyncMailbox(conn, dbAcc.ID, clean)
+				return err
+			})
+			if !connected {
+				showError("IMAP reconnect failed:", err)
+				app.QueueUpdateDraw(func() {
+					cmdBar.ShowMessage(connectionError(dbAcc.Email, err))
+				})
+				return
+			}
 			if err != nil {
-				showError("Failed fetching from "+folderName+":", err)
+				showError("Failed syncing "+folderName+":", err)
 				return
 			}
+			logger.Info("Synced", clean, "- new:", len(result.New), "deleted:", len(result.Deleted), "changed:", result.Changed)
+
+			// the badge would otherwise wait for the next STATUS round
+			counts.Refresh(dbAcc.ID, clean)
 
-			logger.Info("Fetched", len(emails), "emails from", clean)
+			// the cache is now the source of truth, re-read it so rows carry their DB ids
+			emails, err := db.GetEmails(dbAcc.ID, clean, 50)
+			if err != nil {
+				showError("Failed reading cache for "+folderName+":", err)
+				return
+			}
 
 			// now update UI from UI-safe context
 			logger.Info("Queueing UI update with fetched emails...")
 			app.QueueUpdateDraw(func() {
+				if token != selection {
+					return
+				}
 				logger.Info("QueueUpdateDraw: Setting", len(emails), "emails")
 				emailPanel.SetEmails(emails)
-				emailOpenPanel.Clear()
-				app.SetFocus(emailPanel.Primitive())
+				fp.SetFolderEmails(dbAcc.ID, folderName, emails)
+				if !showingCache {
+					emailOpenPanel.Clear()
+					app.SetFocus(emailPanel.Primitive())
+				}
 				logger.Info("UI updated successfully with emails")
 			})
 		}()
@@ -118,7 +206,7 @@ func StartUI(_ []*Account) error {
 
 	// ===== Command Bar (must be created BEFORE folder panel) =====
 	logger.Info("Creating command bar...")
-	cmdBar := NewCommandBar(app)
+	cmdBar = NewCommandBar(app)
 
 	// register commands
 	helpCmd := commands.NewHelpCommand(cmdBar.registry)
@@ -127,7 +215,7 @@ func StartUI(_ []*Account) error {
 
 	// ===== Left Panel (Folder List) =====
 	logger.Info("Creating folder panel...")
-	fp := NewFolderPanel(onSelect, func() {
+	fp = NewFolderPanel(onSelect, func() {
 		// Trigger !addaccount as if typed
 		addCmd := cmdBar.registry["!addaccount"]
 		cmdBar.active = addCmd
@@ -138,6 +226,294 @@ func StartUI(_ []*Account) error {
 		app.SetFocus(cmdBar.input)
 	})
 
+	// ===== Compose Panel (full screen page on top of the main layout) =====
+	pages := tview.NewPages()
+	composing := false
+	var lastFocus tview.Primitive = fp.Primitive()
+
+	var composePanel *ComposePanel
+
+	closeCompose := func() {
+		logger.Info("Closing compose panel")
+		composing = false
+		pages.SwitchToPage("main")
+		app.SetFocus(lastFocus)
+	}
+
+	// askSaveDraft offers to keep an unsent message before the compose page goes away
+	askSaveDraft := func(d compose.Draft) {
+		modal := tview.NewModal().
+			SetText("Save this message as a draft?").
+			AddButtons([]string{"Save draft", "Discard", "Keep editing"}).
+			SetDoneFunc(func(_ int, label string) {
+				pages.RemovePage("confirm")
+				switch label {
+				case "Save draft":
+					if err := compose.Save(&d); err != nil {
+						logger.Error("Saving draft failed:", err)
+						cmdBar.ShowMessage("[red]" + err.Error())
+						app.SetFocus(composePanel.Primitive())
+						return
+					}
+					cmdBar.ShowMessage("Draft saved, reopen it with !drafts")
+					closeCompose()
+
+					// the server copy is a bonus, the local one already keeps the text safe
+					go func() {
+						if err := compose.Upload(d); err != nil {
+							logger.Error("Storing draft on server failed:", err)
+							app.QueueUpdateDraw(func() {
+								cmdBar.ShowMessage("[yellow]Draft saved locally only: " + err.Error())
+							})
+						}
+					}()
+				case "Discard":
+					closeCompose()
+				default:
+					app.SetFocus(composePanel.Primitive())
+				}
+			})
+		pages.AddPage("confirm", modal, false, true)
+		app.SetFocus(modal)
+	}
+
+	sendDraft := func(d compose.Draft) {
+		logger.Info("Sending:", d.Subject)
+		cmdBar.ShowMessage("Sending: " + d.Subject)
+
+		go func() {
+			queued, err := compose.Send(d)
+			app.QueueUpdateDraw(func() {
+				composePanel.SetSending(false)
+				if err != nil {
+					logger.Error("Send failed:", err)
+					cmdBar.ShowMessage("[red]Send failed: " + err.Error())
+					return
+				}
+				if queued {
+					cmdBar.ShowMessage("[yellow]Server unreachable, queued in outbox: " + d.Subject)
+				} else {
+					cmdBar.ShowMessage("Sent: " + d.Subject)
+				}
+				closeCompose()
+			})
+		}()
+	}
+
+	composePanel = NewComposePanel(app, sendDraft, func(d compose.Draft, changed bool) {
+		if changed {
+			askSaveDraft(d)
+			return
+		}
+		closeCompose()
+	})
+
+	openCompose := func(d compose.Draft) {
+		logger.Info("Opening compose panel:", d.Subject)
+		composePanel.SetDraft(d)
+		if !composing {
+			composing = true
+			if focus := app.GetFocus(); focus != cmdBar.input {
+				lastFocus = focus
+			}
+		}
+		pages.SwitchToPage("compose")
+		app.SetFocus(composePanel.Primitive())
+	}
+
+	// real unread counts for the folder badges
+	counts = newUnreadCounts(app, fp)
+
+	// popup for picking where messages go, focus returns to wherever it was
+	pickFolder := func(title string, done func(t FolderTarget)) {
+		back := app.GetFocus()
+		closePicker := func() {
+			pages.RemovePage("picker")
+			app.SetFocus(back)
+		}
+
+		picker, focus := NewFolderPicker(title, fp.Targets(), func(t FolderTarget) {
+			closePicker()
+			done(t)
+		}, closePicker)
+		pages.AddPage("picker", picker, true, true)
+		app.SetFocus(focus)
+	}
+
+	actions = &emailActions{
+		app:         app,
+		list:        emailPanel,
+		open:        emailOpenPanel,
+		folders:     fp,
+		counts:      counts,
+		cmdBar:      cmdBar,
+		openCompose: openCompose,
+		pickFolder:  pickFolder,
+	}
+
+	// per message keys, same in the list and in the open email
+	messageKeys := func(selected func() *models.Email) func(event *tcell.EventKey) *tcell.EventKey {
+		return func(event *tcell.EventKey) *tcell.EventKey {
+			if event.Key() != tcell.KeyRune {
+				return event
+			}
+
+			email := selected()
+			if email == nil {
+				return event
+			}
+
+			switch event.Rune() {
+			case 'u':
+				actions.ToggleSeen(*email)
+				return nil
+			case 's':
+				actions.ToggleStarred(*email)
+				return nil
+			case 'r':
+				actions.Reply(*email)
+				return nil
+			case 'f':
+				actions.Forward(*email)
+				return nil
+			case 'd':
+				actions.Delete(*email)
+				return nil
+			case 'e':
+				actions.EditDraft(*email)
+				return nil
+			case 'm':
+				actions.Move(*email)
+				return nil
+			case 'c':
+				actions.Copy(*email)
+				return nil
+			}
+			return event
+		}
+	}
+	// starts a command as if typed, e.g from a key
+	startCommand := func(name string) {
+		cmd := cmdBar.registry[name]
+		lastFocus = app.GetFocus()
+		cmdBar.active = cmd
+		cmdBar.ShowMessage("Running: " + cmd.Description())
+		cmd.Begin(cmdBar)
+		app.SetFocus(cmdBar.input)
+	}
+
+	listKeys := messageKeys(emailPanel.Selected)
+	emailPanel.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		// search works on an empty list too
+		if event.Key() == tcell.KeyRune && event.Rune() == '/' {
+			startCommand("!search")
+			return nil
+		}
+		if event.Key() == tcell.KeyRune && event.Rune() == '?' {
+			startCommand("!find")
+			return nil
+		}
+		return listKeys(event)
+	})
+	emailOpenPanel.SetInputCapture(messageKeys(emailOpenPanel.GetEmail))
+
+	// connection state badges in the folder panel, the pool calls this from its own goroutines.
+	// changes can arrive out of order, so the badge shows the state as it is when the update runs
+	imap.OnStateChange(func(accountID uint, _ imap.ConnState, _ error) {
+		go app.QueueUpdateDraw(func() {
+			state, _ := imap.State(accountID)
+			fp.SetAccountState(accountID, state)
+		})
+	})
+
+	// loadFolders lists the folders of an account into the folder panel, in the background
+	loadFolders := func(account models.Account) {
+		go func() {
+			logger.Info("Async goroutine started for:", account.Email)
+
+			logger.Info("Getting IMAP connection for folder list:", account.Email)
+			var boxes []imap.Mailbox
+			var subscribed map[string]bool
+			connected := false
+			err := imap.Do(account, func(conn *client.Client) error {
+				connected = true
+				logger.Info("Listing mailboxes for:", account.Email)
+				var err error
+				boxes, err = imap.ListMailboxes(conn)
+				if err != nil || !account.SubscribedOnly {
+					return err
+				}
+				subscribed, err = imap.SubscribedMailboxes(conn)
+				return err
+			})
+			if !connected {
+				logger.Error("IMAP login failed for", account.Email, ":", err)
+				app.QueueUpdateDraw(func() {
+					cmdBar.ShowMessage(connectionError(account.Email, err))
+				})
+				return
+			}
+			if err != nil {
+				logger.Error("Folder fetch failed for", account.Email, ":", err)
+				return
+			}
+			logger.Info("Found", len(boxes), "mailboxes for", account.Email)
+
+			folders := []Folder{}
+			var selectable []string
+			for _, box := range boxes {
+				// INBOX stays even when it isn't subscribed
+				if subscribed != nil && !subscribed[box.Name] && !strings.EqualFold(box.Name, "INBOX") {
+					continue
+				}
+				folders = append(folders, uiFolder(box))
+				if box.Selectable() {
+					selectable = append(selectable, box.Name)
+				}
+			}
+
+			logger.Info("Queueing UI update to add folders for:", account.Email)
+			app.QueueUpdateDraw(func() {
+				logger.Info("QueueUpdateDraw: Updating folders for:", account.Email)
+				for _, uiAccount := range accounts {
+					if uiAccount.ID == account.ID {
+						uiAccount.Folders = folders
+					}
+				}
+				fp.UpdateAccount(account.Email, folders)
+				logger.Info("Folders updated successfully for:", account.Email)
+			})
+			counts.SetFolders(account.ID, selectable)
+		}()
+	}
+
+	// folder management commands do their change through this, the folder list is reloaded after
+	folderOp := func(acc models.Account, done string, fn func(conn *client.Client) error) {
+		go func() {
+			if fn != nil {
+				if err := imap.Do(acc, fn); err != nil {
+					logger.Error("Folder change failed for", acc.Email, ":", err)
+					app.QueueUpdateDraw(func() {
+						cmdBar.ShowMessage("[red]" + tview.Escape(err.Error()))
+					})
+					return
+				}
+			}
+
+			// the command may have changed the account's settings
+			var fresh models.Account
+			if err := db.DB.First(&fresh, acc.ID).Error; err != nil {
+				logger.Error("Failed to reload account", acc.Email, ":", err)
+				return
+			}
+
+			app.QueueUpdateDraw(func() {
+				cmdBar.ShowMessage(done)
+			})
+			loadFolders(fresh)
+		}()
+	}
+
 	// load DB accounts
 	logger.Info("Loading accounts from database...")
 	var accountsList []models.Account
@@ -151,53 +527,146 @@ func StartUI(_ []*Account) error {
 	for _, acc := range accountsList {
 		logger.Info("Processing account:", acc.Email)
 		uiAcc := &Account{
+			ID:      acc.ID,
 			Email:   acc.Email,
 			Folders: []Folder{{Name: "INBOX", Emails: []models.Email{}}}, // Default
 		}
 
 		logger.Info("Adding account to folder panel:", acc.Email)
-		fp.AddAccount(acc.Email, uiAcc.Folders)
+		fp.AddAccount(acc.ID, acc.Email, uiAcc.Folders)
+		if state, _ := imap.State(acc.ID); state != imap.StateNone {
+			fp.SetAccountState(acc.ID, state) // main may have connected already
+		}
 		accounts = append(accounts, uiAcc)
 
 		// Load folders asynchronously
 		logger.Info("Starting async folder load for:", acc.Email)
-		go func(account models.Account, uiAccount *Account) {
-			logger.Info("Async goroutine started for:", account.Email)
+		loadFolders(acc)
+	}
 
-			logger.Info("Getting IMAP connection for folder list:", account.Email)
-			conn, err := imap.GetConnection(account)
-			if err != nil {
-				logger.Error("IMAP login failed for", account.Email, ":", err)
-				return
-			}
-			logger.Info("IMAP connection successful for:", account.Email)
+	// server side search, the results replace the email list until a folder is opened again
+	runSearch := func(q search.Query, input string) {
+		accountID, folder := openAccountID, openFolder
+		if accountID == 0 {
+			cmdBar.ShowMessage("[yellow]Open a folder first, the search runs on its account")
+			return
+		}
+		if q.Folder != "" {
+			folder = q.Folder
+		}
+		scope := folder
+		if q.AllFolders {
+			scope = "all folders"
+		}
 
-			logger.Info("Listing mailboxes for:", account.Email)
-			boxes, err := imap.ListMailboxes(conn)
-			if err != nil {
-				logger.Error("Folder fetch failed for", account.Email, ":", err)
-				return
-			}
-			logger.Info("Found", len(boxes), "mailboxes for", account.Email)
+		// like opening a folder, a folder opened meanwhile wins
+		selection++
+		token := selection
+		cmdBar.ShowMessage("Searching " + tview.Escape(scope) + "...")
 
-			folders := make([]Folder, len(boxes))
-			for i, name := range boxes {
-				folders[i] = Folder{Name: name, Emails: []models.Email{}}
+		go func() {
+			var results []models.Email
+			var acc models.Account
+			err := db.DB.First(&acc, accountID).Error
+			if err == nil {
+				criteria := imap.SearchCriteria(q)
+				err = imap.Do(acc, func(conn *client.Client) error {
+					var err error
+					if q.AllFolders {
+						results, err = imap.SearchAll(conn, acc.ID, criteria, searchLimit)
+					} else {
+						results, err = imap.Search(conn, acc.ID, folder, criteria, searchLimit)
+					}
+					return err
+				})
 			}
 
-			logger.Info("Queueing UI update to add folders for:", account.Email)
 			app.QueueUpdateDraw(func() {
-				logger.Info("QueueUpdateDraw: Updating folders for:", account.Email)
-				uiAccount.Folders = folders
-				fp.UpdateAccount(account.Email, folders)
-				logger.Info("Folders updated successfully for:", account.Email)
+				if token != selection {
+					return
+				}
+				if err != nil {
+					logger.Error("Search failed:", err)
+					cmdBar.ShowMessage("[red]Search failed: " + tview.Escape(err.Error()))
+					return
+				}
+
+				searching = true
+				emailPanel.SetEmails(results)
+				emailPanel.SetTitle(fmt.Sprintf(" 🔍 %s (%d) ", tview.Escape(input), len(results)))
+				emailOpenPanel.Clear()
+				cmdBar.ShowMessage(fmt.Sprintf("%d found in %s, open a folder to go back", len(results), tview.Escape(scope)))
+				app.SetFocus(emailPanel.Primitive())
+				lastFocus = emailPanel.Primitive()
+			})
+		}()
+	}
+
+	// local search over the cache, no connection needed. runs on the open folder,
+	// or on every account when none is open
+	runFind := func(q search.Query, input string) {
+		accountID, folder := openAccountID, openFolder
+		scope := folder
+		switch {
+		case accountID == 0:
+			scope = "all accounts"
+		case q.AllFolders:
+			scope = "all folders"
+		case q.Folder != "":
+			scope = q.Folder
+		}
+
+		selection++
+		token := selection
+
+		go func() {
+			hits, err := db.SearchCache(accountID, folder, q, searchLimit)
+
+			app.QueueUpdateDraw(func() {
+				if token != selection {
+					return
+				}
+				if err != nil {
+					logger.Error("Find failed:", err)
+					cmdBar.ShowMessage("[red]Find failed: " + tview.Escape(err.Error()))
+					return
+				}
+
+				results := make([]models.Email, len(hits))
+				snippets := make(map[uint]string, len(hits))
+				for i, hit := range hits {
+					results[i] = hit.Email
+					snippets[hit.ID] = hit.Snippet
+				}
+
+				searching = true
+				emailPanel.SetSearchResults(results, snippets)
+				emailPanel.SetTitle(fmt.Sprintf(" 🔎 %s (%d) ", tview.Escape(input), len(results)))
+				emailOpenPanel.Clear()
+				cmdBar.ShowMessage(fmt.Sprintf("%d cached found in %s, open a folder to go back", len(results), tview.Escape(scope)))
+				app.SetFocus(emailPanel.Primitive())
+				lastFocus = emailPanel.Primitive()
 			})
-		}(acc, uiAcc)
+		}()
 	}
 
 	// ===== Command Bar =====
 	cmdBar.Register(helpCmd)
 	cmdBar.Register(commands.NewAddAccount())
+	cmdBar.Register(commands.NewComposeCommand(openCompose))
+	cmdBar.Register(commands.NewDraftsCommand(openCompose))
+	cmdBar.Register(commands.NewOutboxCommand())
+	cmdBar.Register(commands.NewTLSCommand())
+	cmdBar.Register(commands.NewPlaintextCommand(folderOp))
+	cmdBar.Register(commands.NewWatchCommand())
+	cmdBar.Register(commands.NewMkFolderCommand(folderOp))
+	cmdBar.Register(commands.NewRmFolderCommand(folderOp))
+	cmdBar.Register(commands.NewMvFolderCommand(folderOp))
+	cmdBar.Register(commands.NewSubscribeCommand(folderOp))
+	cmdBar.Register(commands.NewUnsubscribeCommand(folderOp))
+	cmdBar.Register(commands.NewSubscribedCommand(folderOp))
+	cmdBar.Register(commands.NewSearchCommand(runSearch))
+	cmdBar.Register(commands.NewFindCommand(runFind))
 
 	// ===== Layout =====
 	logger.Info("Building layout...")
@@ -211,11 +680,21 @@ func StartUI(_ []*Account) error {
 	mainLayout.AddItem(upperLayout, 0, 1, true)
 	mainLayout.AddItem(cmdBar.GetPrimitive(), 3, 0, false)
 
-	// navigation
-	var lastFocus tview.Primitive = fp.Primitive()
+	// the command bar stays visible under the compose form for send status
+	composeLayout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(composePanel.Primitive(), 0, 1, true).
+		AddItem(cmdBar.GetPrimitive(), 3, 0, false)
+
+	pages.AddPage("main", mainLayout, true, true)
+	pages.AddPage("compose", composeLayout, true, false)
 
 	logger.Info("Setting up input capture...")
 	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		// the compose form needs arrows and ':' for typing
+		if composing {
+			return event
+		}
+
 		switch event.Key() {
 		case tcell.KeyRight:
 			switch app.GetFocus() {
@@ -261,7 +740,7 @@ func StartUI(_ []*Account) error {
 			logger.Info("Command entered:", input)
 			cmdBar.handleInput(input)
 
-			if cmdBar.active == nil {
+			if cmdBar.active == nil && !composing {
 				logger.Info("Returning focus to last focused panel")
 				app.SetFocus(lastFocus)
 			}
@@ -274,6 +753,110 @@ func StartUI(_ []*Account) error {
 		}
 	})
 
+	// retries queued mail in the background, what is left stays at the end of the command bar hint line
+	outbox.Start(func(subject string) {
+		app.QueueUpdateDraw(func() {
+			cmdBar.ShowMessage("Outbox: sent " + tview.Escape(subject))
+		})
+	}, func(status string) {
+		app.QueueUpdateDraw(func() {
+			cmdBar.SetStatus(status)
+		})
+	})
+
+	// live updates: the watcher follows every account in the background (see !watch),
+	// changes are already in the cache when the event arrives
+	events, unsubscribe := watcher.Subscribe()
+	defer unsubscribe()
+	go func() {
+		for ev := range events {
+			ev := ev
+
+			// re-read the cache off the UI thread, rows from there carry their DB ids
+			cached, err := db.GetEmails(ev.AccountID, ev.Mailbox, 50)
+			if err != nil {
+				logger.Error("Failed reading cache for", ev.Mailbox, ":", err)
+				continue
+			}
+
+			counts.Refresh(ev.AccountID, ev.Mailbox)
+			app.QueueUpdateDraw(func() {
+				fp.SetFolderEmails(ev.AccountID, ev.Mailbox, cached)
+
+				if len(ev.New) > 0 {
+					cmdBar.ShowMessage(fmt.Sprintf("[green]📬 %d new in %s (%s)", len(ev.New), ev.Mailbox, ev.Account))
+				}
+
+				if searching || ev.AccountID != openAccountID || ev.Mailbox != openFolder {
+					return
+				}
+				applyEvent(emailPanel, ev, cached)
+			})
+		}
+	}()
+	watcher.Start()
+	counts.Start()
+
 	logger.Info("Starting TUI application...")
-	return app.SetRoot(mainLayout, true).Run()
+	return app.SetRoot(pages, true).Run()
+}
+
+// connectionError is the command bar text for a failed connect, certificate problems get their own wording
+func connectionError(email string, err error) string {
+	var verifyErr *tlsutil.VerifyError
+	if errors.As(err, &verifyErr) {
+		return "[red]" + email + ": " + tview.Escape(verifyErr.Error()) + " (see !tls)"
+	}
+	return "[red]" + email + ": " + tview.Escape(err.Error())
+}
+
+// applyEvent brings the open email list in line with a watcher event: new mail on top,
+// expunged mail removed, changed flags redrawn
+func applyEvent(list *EmailListPanel, ev watcher.Event, cached []models.Email) {
+	if ev.Reset {
+		list.SetEmails(cached)
+		return
+	}
+
+	if len(ev.New) > 0 {
+		arrived := make(map[uint32]bool, len(ev.New))
+		for _, e := range ev.New {
+			arrived[e.UID] = true
+		}
+
+		var fresh []models.Email
+		for _, e := range cached {
+			if arrived[e.UID] {
+				fresh = append(fresh, e)
+			}
+		}
+		list.PrependEmails(fresh)
+	}
+
+	if len(ev.Deleted) > 0 {
+		list.RemoveUIDs(ev.Deleted)
+	}
+
+	if ev.Changed > 0 {
+		listed := make(map[uint]models.Email)
+		for _, e := range list.Emails() {
+			listed[e.ID] = e
+		}
+		for _, e := range cached {
+			if old, ok := listed[e.ID]; ok && old != e {
+				list.UpdateEmail(e)
+			}
+		}
+	}
+}
+
+// uiFolder turns a LIST entry into a folder panel entry
+func uiFolder(box imap.Mailbox) Folder {
+	return Folder{
+		Name:       box.Name,
+		Emails:     []models.Email{},
+		Delimiter:  box.Delimiter,
+		SpecialUse: box.SpecialUse(),
+		Noselect:   !box.Selectable(),
+	}
 }
@@ -0,0 +1,99 @@
+package ui
+
+import (
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap/client"
+	"github.com/rivo/tview"
+	"github.com/vky5/mailcat/internal/db"
+	"github.com/vky5/mailcat/internal/db/models"
+	"github.com/vky5/mailcat/internal/imap"
+	"github.com/vky5/mailcat/internal/logger"
+)
+
+// every folder's counts are asked for again this often, watched folders get updated in between
+const countsInterval = 5 * time.Minute
+
+// unreadCounts keeps the folder panel badges in line with the server using STATUS,
+// so folders show their real counts without being opened
+type unreadCounts struct {
+	app     *tview.Application
+	folders *FolderPanel
+
+	mu    sync.Mutex
+	known map[uint][]string // listed folders of each account
+}
+
+func newUnreadCounts(app *tview.Application, folders *FolderPanel) *unreadCounts {
+	return &unreadCounts{
+		app:     app,
+		folders: folders,
+		known:   make(map[uint][]string),
+	}
+}
+
+// SetFolders records the folders listed for an account and fetches their counts
+func (uc *unreadCounts) SetFolders(accountID uint, folders []string) {
+	uc.mu.Lock()
+	uc.known[accountID] = folders
+	uc.mu.Unlock()
+
+	uc.Refresh(accountID)
+}
+
+// Refresh fetches the counts of some folders of an account in the background, all of its folders when none are given
+func (uc *unreadCounts) Refresh(accountID uint, mailboxes ...string) {
+	if len(mailboxes) == 0 {
+		uc.mu.Lock()
+		mailboxes = uc.known[accountID]
+		uc.mu.Unlock()
+	}
+	if len(mailboxes) == 0 {
+		return
+	}
+
+	go func() {
+		var acc models.Account
+		if err := db.DB.First(&acc, accountID).Error; err != nil {
+			logger.Error("Failed to load account for folder counts:", err)
+			return
+		}
+
+		var counts map[string]imap.FolderStatus
+		err := imap.Do(acc, func(conn *client.Client) error {
+			var err error
+			counts, err = imap.FolderStatuses(conn, mailboxes)
+			return err
+		})
+		if err != nil {
+			logger.Error("Folder counts failed for", acc.Email, ":", err)
+			return
+		}
+
+		uc.app.QueueUpdateDraw(func() {
+			uc.folders.SetFolderCounts(accountID, counts)
+		})
+	}()
+}
+
+// Start refreshes every known folder every countsInterval, until the program exits
+func (uc *unreadCounts) Start() {
+	go func() {
+		ticker := time.NewTicker(countsInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			uc.mu.Lock()
+			accounts := make([]uint, 0, len(uc.known))
+			for id := range uc.known {
+				accounts = append(accounts, id)
+			}
+			uc.mu.Unlock()
+
+			for _, id := range accounts {
+				uc.Refresh(id)
+			}
+		}
+	}()
+}
@@ -0,0 +1,445 @@
+package watcher
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/vky5/mailcat/internal/db"
+	"github.com/vky5/mailcat/internal/db/models"
+	mailimap "github.com/vky5/mailcat/internal/imap"
+	"github.com/vky5/mailcat/internal/logger"
+)
+
+const (
+	// folders beyond this many are polled instead of getting their own IDLE connection,
+	// servers only allow a handful of connections per user
+	maxIdleFolders = 3
+
+	pollInterval = 2 * time.Minute
+	retryDelay   = time.Minute
+
+	// reports about the same mailbox within this window end up in one sync
+	debounce = 500 * time.Millisecond
+)
+
+var statusItems = []imap.StatusItem{imap.StatusMessages, imap.StatusUidNext, imap.StatusUidValidity, imap.StatusUnseen}
+
+// watch methods, picked once the capabilities are known
+type method int
+
+const (
+	methodUnknown method = iota
+	methodNotify
+	methodIdle
+	methodPoll
+)
+
+// notifyKey is the DoIdle key of the NOTIFY connection, folders use their name
+const notifyKey = "notify"
+
+// accountWatcher follows the folders of one account, with the best method the server offers:
+// - NOTIFY: one connection reports on every folder
+// - IDLE: one connection per folder, up to maxIdleFolders
+// - STATUS polling for everything else
+// folders can be added and removed while it runs
+type accountWatcher struct {
+	acc  models.Account
+	stop chan struct{}
+	once sync.Once
+
+	mu      sync.Mutex
+	folders []string
+	method  method
+	idling  map[string]chan struct{} // folders with an IDLE connection, closing the channel ends it
+	resub   chan struct{}            // closed when the folders change, NOTIFY has to be set again
+	pending map[string]bool
+	last    map[string]mailboxStatus // STATUS answer of the previous poll
+}
+
+// mailboxStatus is the part of a STATUS answer compared between polls
+type mailboxStatus struct {
+	messages, uidNext, uidValidity, unseen uint32
+}
+
+func newAccountWatcher(acc models.Account, folders []string) *accountWatcher {
+	return &accountWatcher{
+		acc:     acc,
+		folders: folders,
+		stop:    make(chan struct{}),
+		idling:  make(map[string]chan struct{}),
+		resub:   make(chan struct{}),
+		pending: make(map[string]bool),
+		last:    make(map[string]mailboxStatus),
+	}
+}
+
+func (w *accountWatcher) close() {
+	w.once.Do(func() { close(w.stop) })
+}
+
+func (w *accountWatcher) stopped() bool {
+	select {
+	case <-w.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// sleep waits d, false when the watcher got stopped meanwhile
+func (w *accountWatcher) sleep(d time.Duration) bool {
+	select {
+	case <-w.stop:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+func (w *accountWatcher) run() {
+	logger.Info("Watching", w.watched(), "of", w.acc.Email)
+
+	// the capabilities decide how to watch, wait for the server to be reachable
+	var notify, idle bool
+	for {
+		err := mailimap.Do(w.acc, func(conn *client.Client) error {
+			notify = mailimap.SupportsNotify(conn)
+			idle, _ = conn.Support("IDLE")
+			return nil
+		})
+		if err == nil {
+			break
+		}
+		logger.Warn("Watcher can't reach", w.acc.Email, ":", err)
+		if !w.sleep(retryDelay) {
+			return
+		}
+	}
+
+	// catch up on whatever arrived while nobody was watching
+	w.poll(w.watched())
+
+	if notify {
+		w.setMethod(methodNotify)
+		if w.watchNotify() {
+			return
+		}
+	}
+
+	if idle {
+		w.setMethod(methodIdle)
+	} else {
+		w.setMethod(methodPoll)
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			if polled := w.polled(); len(polled) > 0 {
+				w.poll(polled)
+			}
+		}
+	}
+}
+
+// watched returns a copy of the folders followed right now
+func (w *accountWatcher) watched() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return slices.Clone(w.folders)
+}
+
+// polled returns the folders left to STATUS polling, the ones without NOTIFY or an IDLE connection
+func (w *accountWatcher) polled() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var polled []string
+	for _, folder := range w.folders {
+		if w.idling[folder] == nil {
+			polled = append(polled, folder)
+		}
+	}
+	return polled
+}
+
+// setMethod switches to a watch method, with IDLE the first folders get their connections
+func (w *accountWatcher) setMethod(m method) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.method = m
+	if m == methodIdle {
+		for _, folder := range w.folders {
+			w.startIdle(folder)
+		}
+	}
+}
+
+// startIdle gives folder its own IDLE connection while there are some left, caller holds mu
+func (w *accountWatcher) startIdle(folder string) {
+	if len(w.idling) >= maxIdleFolders || w.idling[folder] != nil {
+		return
+	}
+
+	quit := make(chan struct{})
+	w.idling[folder] = quit
+	go w.watchIdle(folder, quit)
+}
+
+// add starts watching folder with whatever method is in use
+func (w *accountWatcher) add(folder string) {
+	w.mu.Lock()
+	if slices.Contains(w.folders, folder) {
+		w.mu.Unlock()
+		return
+	}
+	w.folders = append(w.folders, folder)
+
+	switch w.method {
+	case methodNotify:
+		close(w.resub)
+		w.resub = make(chan struct{})
+	case methodIdle:
+		w.startIdle(folder)
+	}
+	// the first poll only notes the status, later ones compare with it.
+	// before a method is picked run does this for every folder anyway
+	baseline := w.method != methodUnknown && w.idling[folder] == nil
+	w.mu.Unlock()
+
+	if baseline {
+		go w.poll([]string{folder})
+	}
+}
+
+// remove stops watching folder, its IDLE connection goes to the next polled folder
+func (w *accountWatcher) remove(folder string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	i := slices.Index(w.folders, folder)
+	if i < 0 {
+		return
+	}
+	w.folders = slices.Delete(w.folders, i, i+1)
+	delete(w.last, folder)
+
+	switch w.method {
+	case methodNotify:
+		close(w.resub)
+		w.resub = make(chan struct{})
+	case methodIdle:
+		if quit := w.idling[folder]; quit != nil {
+			close(quit)
+			delete(w.idling, folder)
+			for _, f := range w.folders {
+				w.startIdle(f)
+			}
+		}
+	}
+}
+
+// watchNotify follows all folders over one NOTIFY connection until stopped, NOTIFY is set again when they change.
+// false means the server turned NOTIFY down after all and another method is needed
+func (w *accountWatcher) watchNotify() bool {
+	defer mailimap.ReleaseIdle(w.acc.ID, notifyKey)
+
+	for {
+		w.mu.Lock()
+		folders, resub := slices.Clone(w.folders), w.resub
+		w.mu.Unlock()
+
+		// ends the session on stop and on folder changes
+		session := make(chan struct{})
+		ended := make(chan struct{})
+		go func() {
+			select {
+			case <-w.stop:
+			case <-resub:
+			case <-ended:
+			}
+			close(session)
+		}()
+
+		err := mailimap.DoIdle(w.acc, notifyKey, func(conn *client.Client) error {
+			return mailimap.NotifyMailboxes(conn, folders, w.kick, w.kickAll, session)
+		})
+		close(ended)
+
+		if w.stopped() {
+			return true
+		}
+		if errors.Is(err, mailimap.ErrNotifyRejected) {
+			logger.Warn("Falling back to IDLE for", w.acc.Email, ":", err)
+			return false
+		}
+
+		select {
+		case <-resub:
+			// folders changed, NOTIFY again with the new list
+			if err == nil {
+				continue
+			}
+		default:
+		}
+
+		logger.Warn("NOTIFY watch of", w.acc.Email, "broke:", err)
+		if !w.sleep(retryDelay) {
+			return true
+		}
+		w.kickAll()
+	}
+}
+
+// watchIdle keeps an IDLE connection on one folder until the watcher is stopped or quit is closed,
+// then the connection is logged out
+func (w *accountWatcher) watchIdle(folder string, quit chan struct{}) {
+	defer mailimap.ReleaseIdle(w.acc.ID, folder)
+
+	// ends the IDLE on either
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-w.stop:
+		case <-quit:
+		}
+		close(done)
+	}()
+
+	for {
+		err := mailimap.DoIdle(w.acc, folder, func(conn *client.Client) error {
+			return mailimap.IdleMailbox(conn, folder, func() { w.kick(folder) }, done)
+		})
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		logger.Warn("IDLE on", folder, "of", w.acc.Email, "broke:", err)
+		select {
+		case <-done:
+			return
+		case <-time.After(retryDelay):
+		}
+		// mail may have come in while the connection was down
+		w.kick(folder)
+	}
+}
+
+// poll asks STATUS for folders and syncs the ones that look different from last time.
+// the first time around they are compared with the sync state in the DB
+func (w *accountWatcher) poll(folders []string) {
+	var changed []string
+	err := mailimap.Do(w.acc, func(conn *client.Client) error {
+		for _, folder := range folders {
+			answer, err := conn.Status(folder, statusItems)
+			if err != nil {
+				logger.Warn("STATUS of", folder, "failed:", err)
+				continue
+			}
+			status := mailboxStatus{answer.Messages, answer.UidNext, answer.UidValidity, answer.Unseen}
+
+			w.mu.Lock()
+			last, seen := w.last[folder]
+			w.last[folder] = status
+			w.mu.Unlock()
+
+			if seen {
+				if status != last {
+					changed = append(changed, folder)
+				}
+				continue
+			}
+
+			// never synced folders are left for when they're opened, all of it would look new
+			state, err := db.GetMailboxState(w.acc.ID, folder)
+			if err != nil {
+				logger.Error("Failed to load sync state of", folder, ":", err)
+				continue
+			}
+			if state.UIDNext != 0 && (state.UIDNext != status.uidNext || state.UIDValidity != status.uidValidity) {
+				changed = append(changed, folder)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Warn("Polling", w.acc.Email, "failed:", err)
+		return
+	}
+
+	for _, folder := range changed {
+		w.sync(folder)
+	}
+}
+
+// kick schedules a sync of mailbox. it's called from IMAP reader goroutines, so it must not block
+func (w *accountWatcher) kick(mailbox string) {
+	w.mu.Lock()
+	if w.pending[mailbox] {
+		w.mu.Unlock()
+		return
+	}
+	w.pending[mailbox] = true
+	w.mu.Unlock()
+
+	time.AfterFunc(debounce, func() {
+		w.mu.Lock()
+		delete(w.pending, mailbox)
+		w.mu.Unlock()
+		w.sync(mailbox)
+	})
+}
+
+func (w *accountWatcher) kickAll() {
+	for _, folder := range w.watched() {
+		w.kick(folder)
+	}
+}
+
+// sync pulls the changes of mailbox into the cache and tells the subscribers about them
+func (w *accountWatcher) sync(mailbox string) {
+	if w.stopped() {
+		return
+	}
+
+	// the first sync of a folder only fills the cache, that isn't news
+	state, err := db.GetMailboxState(w.acc.ID, mailbox)
+	firstSync := err == nil && state.UIDNext == 0
+
+	var result *mailimap.SyncResult
+	err = mailimap.Do(w.acc, func(conn *client.Client) error {
+		var err error
+		result, err = mailimap.SyncMailbox(conn, w.acc.ID, mailbox)
+		return err
+	})
+	if err != nil {
+		logger.Warn("Watcher sync of", mailbox, "failed:", err)
+		return
+	}
+
+	if firstSync || len(result.New) == 0 && len(result.Deleted) == 0 && result.Changed == 0 && !result.Reset {
+		return
+	}
+	logger.Info("Watcher:", mailbox, "of", w.acc.Email, "- new:", len(result.New), "deleted:", len(result.Deleted), "changed:", result.Changed)
+
+	publish(Event{
+		AccountID: w.acc.ID,
+		Account:   w.acc.Email,
+		Mailbox:   mailbox,
+		New:       result.New,
+		Deleted:   result.Deleted,
+		Changed:   result.Changed,
+		Reset:     result.Reset,
+	})
+}
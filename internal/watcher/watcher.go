@@ -0,0 +1,180 @@
+package watcher
+
+import (
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/vky5/mailcat/internal/db"
+	"github.com/vky5/mailcat/internal/db/models"
+	"github.com/vky5/mailcat/internal/logger"
+)
+
+// Event is a watched mailbox that changed on the server. the change is already in the local cache
+type Event struct {
+	AccountID uint
+	Account   string // email of the account
+	Mailbox   string
+	New       []models.Email // newest first
+	Deleted   []uint32       // UIDs
+	Changed   int            // messages whose flags changed
+	Reset     bool           // UIDVALIDITY changed, the cached copy was rebuilt
+}
+
+var (
+	mu       sync.Mutex
+	started  bool
+	watchers = make(map[uint]*accountWatcher)
+
+	// folders subscribers asked for on top of the configured ones, counted per subscriber
+	follows = make(map[uint]map[string]int)
+
+	subsMu  sync.Mutex
+	subs    = make(map[int]chan Event)
+	nextSub int
+)
+
+// Start begins watching every account, calling it again does nothing
+func Start() {
+	mu.Lock()
+	if started {
+		mu.Unlock()
+		return
+	}
+	started = true
+	mu.Unlock()
+
+	var accounts []models.Account
+	if err := db.DB.Find(&accounts).Error; err != nil {
+		logger.Error("Watcher failed to load accounts:", err)
+		return
+	}
+
+	for _, acc := range accounts {
+		Restart(acc.ID)
+	}
+}
+
+// Restart (re)starts the watcher of an account with its current settings, after they changed or it was added
+func Restart(accountID uint) {
+	var acc models.Account
+	if err := db.DB.First(&acc, accountID).Error; err != nil {
+		logger.Error("Watcher failed to load account", accountID, ":", err)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !started {
+		return
+	}
+
+	if old, ok := watchers[accountID]; ok {
+		old.close()
+	}
+
+	w := newAccountWatcher(acc, foldersOf(acc))
+	watchers[accountID] = w
+	go w.run()
+}
+
+// Folders returns the folders watched for an account by configuration, INBOX unless set otherwise
+func Folders(acc models.Account) []string {
+	var folders []string
+	for _, f := range strings.Split(acc.WatchFolders, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			folders = append(folders, f)
+		}
+	}
+
+	if len(folders) == 0 {
+		return []string{"INBOX"}
+	}
+	return folders
+}
+
+// foldersOf adds the followed folders to the configured ones, caller holds mu
+func foldersOf(acc models.Account) []string {
+	folders := Folders(acc)
+
+	seen := make(map[string]bool, len(folders))
+	for _, f := range folders {
+		seen[f] = true
+	}
+	for f := range follows[acc.ID] {
+		if !seen[f] {
+			folders = append(folders, f)
+		}
+	}
+
+	return folders
+}
+
+// Follow watches mailbox until the returned func is called, even if it isn't one of the configured folders.
+// the running watcher picks it up without reconnecting the other folders
+func Follow(accountID uint, mailbox string) func() {
+	mu.Lock()
+	if follows[accountID] == nil {
+		follows[accountID] = make(map[string]int)
+	}
+	follows[accountID][mailbox]++
+	if w, ok := watchers[accountID]; ok && follows[accountID][mailbox] == 1 {
+		w.add(mailbox)
+	}
+	mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			mu.Lock()
+			defer mu.Unlock()
+
+			follows[accountID][mailbox]--
+			if follows[accountID][mailbox] > 0 {
+				return
+			}
+			delete(follows[accountID], mailbox)
+
+			// configured folders stay watched
+			if w, ok := watchers[accountID]; ok && !slices.Contains(Folders(w.acc), mailbox) {
+				w.remove(mailbox)
+			}
+		})
+	}
+}
+
+// Subscribe returns a channel getting every event from now on, and the func to stop
+func Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, 64)
+
+	subsMu.Lock()
+	id := nextSub
+	nextSub++
+	subs[id] = ch
+	subsMu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			subsMu.Lock()
+			delete(subs, id)
+			subsMu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// publish hands ev to every subscriber. a subscriber that fell behind misses it, the cache has it anyway
+func publish(ev Event) {
+	subsMu.Lock()
+	defer subsMu.Unlock()
+
+	for _, ch := range subs {
+		select {
+		case ch <- ev:
+		default:
+			logger.Warn("Watcher subscriber is full, dropped event for", ev.Mailbox)
+		}
+	}
+}